@@ -1,54 +1,124 @@
 // ===================================================================================
 // File: ddns-client/api/client.go
 // Description: 封装所有与服务端的API交互。
+// 请求载荷使用用户密钥加密发送；服务端的响应同样以加密信封 (security.Envelope) 返回，由 SendSecureRequest 透明解密。
+// 用户名、HTTP 方法和接口路径作为附加认证数据绑定到密文上。配置了 device_name 时，请求还会带上设备私钥的 Ed25519 签名。
 // ===================================================================================
 package api
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/keepsea/goddns/ddns_client/config"
 	"github.com/keepsea/goddns/ddns_client/security"
 )
 
-type BaseRequest struct {
-	Username string `json:"username"`
-	Data     string `json:"data"`
+// ServerError 表示服务端返回的非 200 响应。Code 为服务端给出的机器可读错误码（如 totp_required），可能为空。
+type ServerError struct {
+	StatusCode int
+	Code       string
+	Message    string
 }
 
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("服务端返回错误 (状态码: %d): %s", e.StatusCode, e.Message)
+}
+
+// SendSecureRequest 加密并发送载荷，返回解密后的响应内容 (JSON)。
+// 载荷在加密前会自动附带当前时间戳和随机请求ID，供服务端拒绝重放的请求。
 func SendSecureRequest(endpoint string, method string, payload interface{}) ([]byte, error) {
-	payloadBytes, err := json.Marshal(payload)
+	payloadBytes, err := withReplayFields(payload)
 	if err != nil {
 		return nil, fmt.Errorf("序列化载荷失败: %w", err)
 	}
-	encryptedData, err := security.Encrypt([]byte(config.App.EncryptionKey), payloadBytes)
+	requestAD := security.AssociatedData(security.DirectionRequest, config.App.Username, method, endpoint)
+	encryptedData, err := security.Encrypt([]byte(config.App.EncryptionKey), payloadBytes, requestAD)
 	if err != nil {
 		return nil, fmt.Errorf("加密载荷失败: %w", err)
 	}
-	finalRequest := BaseRequest{Username: config.App.Username, Data: encryptedData}
+	finalRequest := security.Envelope{Version: security.EnvelopeVersion, Username: config.App.Username, Data: encryptedData}
+	if config.App.DeviceName != "" {
+		deviceKey, err := security.LoadDeviceKey(config.App.DeviceKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		finalRequest.Device = config.App.DeviceName
+		finalRequest.Signature = security.Sign(deviceKey, security.SigningInput(requestAD, encryptedData))
+	}
 	finalRequestBytes, _ := json.Marshal(finalRequest)
 	req, err := http.NewRequest(method, config.App.ServerURL+endpoint, bytes.NewBuffer(finalRequestBytes))
 	if err != nil {
 		return nil, fmt.Errorf("创建HTTP请求失败: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	return SendRequest(req)
-}
 
-// SendRequest 是一个用于发送简单、无需加密请求体（如GET）的辅助函数。
-func SendRequest(req *http.Request) ([]byte, error) {
-	resp, err := http.DefaultClient.Do(req)
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("发送请求失败: %w", err)
 	}
 	defer resp.Body.Close()
 	body, _ := io.ReadAll(resp.Body)
+
+	responseAD := security.AssociatedData(security.DirectionResponse, config.App.Username, method, endpoint)
+	plaintext, decryptErr := decryptResponse(body, responseAD)
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("服务端返回错误 (状态码: %d): %s", resp.StatusCode, string(body))
+		serverErr := &ServerError{StatusCode: resp.StatusCode, Message: string(bytes.TrimSpace(body))}
+		if decryptErr == nil {
+			var errResp struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			if json.Unmarshal(plaintext, &errResp) == nil && errResp.Message != "" {
+				serverErr.Code = errResp.Code
+				serverErr.Message = errResp.Message
+			}
+		}
+		return nil, serverErr
+	}
+	if decryptErr != nil {
+		return nil, fmt.Errorf("解密服务端响应失败: %w", decryptErr)
+	}
+	return plaintext, nil
+}
+
+// withReplayFields 序列化载荷，并在其顶层加入 timestamp 和 request_id 字段。
+func withReplayFields(payload interface{}) ([]byte, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	fields["timestamp"], _ = json.Marshal(time.Now().Unix())
+	fields["request_id"], _ = json.Marshal(hex.EncodeToString(nonce))
+	return json.Marshal(fields)
+}
+
+// decryptResponse 解析响应信封并用当前密钥解密。
+func decryptResponse(body, additionalData []byte) ([]byte, error) {
+	var envelope security.Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Data == "" {
+		return nil, fmt.Errorf("响应不是加密信封格式")
+	}
+	if envelope.Version != security.EnvelopeVersion {
+		return nil, fmt.Errorf("不支持的加密信封版本 %d", envelope.Version)
 	}
-	return body, nil
+	return security.Decrypt([]byte(config.App.EncryptionKey), envelope.Data, additionalData)
 }
@@ -0,0 +1,101 @@
+// ===================================================================================
+// File: ddns-client/api/transport.go
+// Description: 根据 config.ini 构造与服务端通信使用的 HTTP 客户端。
+// - ca_file: 使用指定的 CA 证书 (PEM) 校验服务端证书，适用于自签 CA。
+// - cert_fingerprint: 固定服务端证书的 SHA-256 指纹。单独配置时只比对指纹而不校验证书链，适用于自签证书。
+// - client_cert / client_key: 向服务端出示客户端证书 (mTLS)，证书名称映射到用户后可省略 secret_token。
+// ===================================================================================
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keepsea/goddns/ddns_client/config"
+)
+
+var (
+	sharedClient    *http.Client
+	sharedClientErr error
+	sharedOnce      sync.Once
+)
+
+// httpClient 返回按配置构造的 HTTP 客户端，整个进程内只构造一次。
+func httpClient() (*http.Client, error) {
+	sharedOnce.Do(func() {
+		sharedClient, sharedClientErr = newHTTPClient()
+	})
+	return sharedClient, sharedClientErr
+}
+
+func newHTTPClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if config.App.CAFile != "" {
+		pem, err := os.ReadFile(config.App.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("无法读取 ca_file %s: %w", config.App.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file %s 中没有有效的 PEM 证书", config.App.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.App.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(config.App.ClientCert, config.App.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if config.App.CertFingerprint != "" {
+		fingerprint, err := parseFingerprint(config.App.CertFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		if config.App.CAFile == "" {
+			// 指纹已经唯一确定了服务端证书，此时不再要求证书链可被系统 CA 验证。
+			tlsConfig.InsecureSkipVerify = true
+		}
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("服务端未提供证书")
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			if !bytes.Equal(sum[:], fingerprint) {
+				return fmt.Errorf("服务端证书指纹不匹配 (实际为 %s)", hex.EncodeToString(sum[:]))
+			}
+			return nil
+		}
+	}
+
+	if (config.App.CAFile != "" || config.App.CertFingerprint != "" || config.App.ClientCert != "") && !strings.HasPrefix(config.App.ServerURL, "https://") {
+		return nil, fmt.Errorf("配置了 ca_file、cert_fingerprint 或 client_cert，但 server_url 不是 https:// 地址")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}, nil
+}
+
+// parseFingerprint 解析十六进制的 SHA-256 指纹，允许使用冒号分隔（与 openssl 输出格式一致）。
+func parseFingerprint(s string) ([]byte, error) {
+	cleaned := strings.ReplaceAll(strings.TrimSpace(s), ":", "")
+	fingerprint, err := hex.DecodeString(cleaned)
+	if err != nil || len(fingerprint) != sha256.Size {
+		return nil, fmt.Errorf("cert_fingerprint 格式错误，应为 64 位十六进制的 SHA-256 指纹")
+	}
+	return fingerprint, nil
+}
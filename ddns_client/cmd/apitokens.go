@@ -0,0 +1,108 @@
+// ===================================================================================
+// File: ddns-client/cmd/apitokens.go
+// Description: 负责执行 'create-token'、'list-tokens' 和 'revoke-token' 命令，管理带权限范围的 API 令牌。
+// API 令牌可以代替 secret_token 写入其他设备的 config.ini，或作为路由器 dyndns2 的密码，只拥有签发时指定的权限。
+// ===================================================================================
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/keepsea/goddns/ddns_client/api"
+	"github.com/keepsea/goddns/ddns_client/config"
+)
+
+type apiTokenRequest struct {
+	SecretToken   string `json:"secret_token"`
+	Action        string `json:"action"`
+	Name          string `json:"name,omitempty"`
+	Scope         string `json:"scope,omitempty"`
+	Record        string `json:"record,omitempty"`
+	Line          string `json:"line,omitempty"`
+	ExpiresInDays int    `json:"expires_in_days,omitempty"`
+}
+
+// RunCreateToken 签发一个 API 令牌。scope 为 update、read 或 full；record/line 仅对 update 有效；days 为 0 表示永不过期。
+func RunCreateToken(name, scope, record, line string, days int) {
+	payload := apiTokenRequest{
+		SecretToken:   config.App.SecretToken,
+		Action:        "create",
+		Name:          name,
+		Scope:         scope,
+		Record:        record,
+		Line:          line,
+		ExpiresInDays: days,
+	}
+	body, err := api.SendSecureRequest("/manage-api-tokens", http.MethodPost, payload)
+	if err != nil {
+		log.Fatalf("错误: 签发令牌失败: %v", err)
+	}
+	var resp struct {
+		Token     string `json:"token"`
+		ExpiresAt string `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		log.Fatalf("错误: 解析服务端响应失败: %v", err)
+	}
+	expiry := "永不过期"
+	if resp.ExpiresAt != "" {
+		expiry = "有效期至 " + resp.ExpiresAt
+	}
+	log.Printf("成功: 已签发令牌 '%s' (范围: %s, %s)。令牌只显示这一次，请妥善保存:", name, scope, expiry)
+	fmt.Println(resp.Token)
+}
+
+// RunListTokens 列出已签发的 API 令牌。
+func RunListTokens() {
+	body, err := api.SendSecureRequest("/manage-api-tokens", http.MethodPost, apiTokenRequest{SecretToken: config.App.SecretToken, Action: "list"})
+	if err != nil {
+		log.Fatalf("错误: %v", err)
+	}
+	var resp struct {
+		Tokens []struct {
+			Name      string `json:"name"`
+			Scope     string `json:"scope"`
+			Record    string `json:"record"`
+			Line      string `json:"line"`
+			CreatedAt string `json:"created_at"`
+			ExpiresAt string `json:"expires_at"`
+			Expired   bool   `json:"expired"`
+		} `json:"tokens"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		log.Fatalf("错误: 解析服务端响应失败: %v", err)
+	}
+	if len(resp.Tokens) == 0 {
+		log.Println("您当前没有签发任何 API 令牌。")
+		return
+	}
+	log.Println("您已签发的 API 令牌如下:")
+	for _, token := range resp.Tokens {
+		target := ""
+		if token.Record != "" {
+			target = " 记录: " + token.Record
+		}
+		if token.Line != "" {
+			target += " 线路: " + token.Line
+		}
+		expiry := "永不过期"
+		if token.ExpiresAt != "" {
+			expiry = "过期时间: " + token.ExpiresAt
+		}
+		if token.Expired {
+			expiry += " (已过期)"
+		}
+		fmt.Printf("- %s  范围: %s%s  签发时间: %s  %s\n", token.Name, token.Scope, target, token.CreatedAt, expiry)
+	}
+}
+
+// RunRevokeToken 按名称吊销一个 API 令牌。
+func RunRevokeToken(name string) {
+	if _, err := api.SendSecureRequest("/manage-api-tokens", http.MethodPost, apiTokenRequest{SecretToken: config.App.SecretToken, Action: "revoke", Name: name}); err != nil {
+		log.Fatalf("错误: 吊销令牌失败: %v", err)
+	}
+	log.Printf("成功: 令牌 '%s' 已吊销。", name)
+}
@@ -0,0 +1,94 @@
+// ===================================================================================
+// File: ddns-client/cmd/devices.go
+// Description: 负责执行 'enroll-device'、'list-devices' 和 'revoke-device' 命令。
+// 每台设备在本地生成自己的 Ed25519 私钥，只把公钥登记到服务端；之后请求由设备私钥签名，不再需要 secret_token。
+// ===================================================================================
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/keepsea/goddns/ddns_client/api"
+	"github.com/keepsea/goddns/ddns_client/config"
+	"github.com/keepsea/goddns/ddns_client/security"
+)
+
+type deviceRequest struct {
+	SecretToken string `json:"secret_token"`
+	Action      string `json:"action"`
+	Name        string `json:"name,omitempty"`
+	PublicKey   string `json:"public_key,omitempty"`
+}
+
+// RunEnrollDevice 为本机生成设备密钥，并以设备名 name 登记到服务端。
+func RunEnrollDevice(name string) {
+	keyFile := config.App.DeviceKeyFile
+	privateKey, err := security.GenerateDeviceKey(keyFile)
+	if err != nil {
+		log.Fatalf("错误: %v (如需重新登记，请先删除旧的私钥文件或在 config.ini 中指定新的 device_key_file)", err)
+	}
+	payload := deviceRequest{
+		SecretToken: config.App.SecretToken,
+		Action:      "enroll",
+		Name:        name,
+		PublicKey:   security.EncodePublicKey(privateKey),
+	}
+	if _, err := api.SendSecureRequest("/manage-devices", http.MethodPost, payload); err != nil {
+		os.Remove(keyFile)
+		log.Fatalf("错误: 登记设备失败: %v", err)
+	}
+	log.Printf("成功: 设备 '%s' 已登记 (公钥指纹: %s)，私钥保存在 %s。", name, security.PublicKeyFingerprint(privateKey), keyFile)
+	if err := config.SaveDevice(name, keyFile); err != nil {
+		log.Fatalf("设备已登记，但无法自动更新config.ini文件: %v\n请手动添加以下配置:\ndevice_name = %s\ndevice_key_file = %s", err, name, keyFile)
+	}
+	log.Println("config.ini 已更新。确认本机可以正常使用后，即可从 config.ini 中删除 secret_token。")
+}
+
+// RunListDevices 列出当前用户已登记的设备。
+func RunListDevices() {
+	body, err := api.SendSecureRequest("/manage-devices", http.MethodPost, deviceRequest{SecretToken: config.App.SecretToken, Action: "list"})
+	if err != nil {
+		log.Fatalf("错误: %v", err)
+	}
+	var resp struct {
+		Devices []struct {
+			Name        string `json:"name"`
+			Fingerprint string `json:"fingerprint"`
+			CreatedAt   string `json:"created_at"`
+		} `json:"devices"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		log.Fatalf("错误: 解析服务端响应失败: %v", err)
+	}
+	if len(resp.Devices) == 0 {
+		log.Println("您当前没有登记任何设备。")
+		return
+	}
+	log.Println("您已登记的设备如下:")
+	for _, device := range resp.Devices {
+		current := ""
+		if device.Name == config.App.DeviceName {
+			current = " (本机)"
+		}
+		fmt.Printf("- %s  指纹: %s  登记时间: %s%s\n", device.Name, device.Fingerprint, device.CreatedAt, current)
+	}
+}
+
+// RunRevokeDevice 吊销一台已登记的设备。吊销的是本机时，同时清除 config.ini 中的设备配置。
+func RunRevokeDevice(name string) {
+	if _, err := api.SendSecureRequest("/manage-devices", http.MethodPost, deviceRequest{SecretToken: config.App.SecretToken, Action: "revoke", Name: name}); err != nil {
+		log.Fatalf("错误: 吊销设备失败: %v", err)
+	}
+	log.Printf("成功: 设备 '%s' 已吊销，其私钥无法再用于认证。", name)
+	if name == config.App.DeviceName {
+		if err := config.SaveDevice("", ""); err != nil {
+			log.Printf("警告: 无法从config.ini中清除本机的设备配置: %v", err)
+			return
+		}
+		log.Println("吊销的是本机，config.ini 中的 device_name 已清除。")
+	}
+}
@@ -15,23 +15,16 @@ import (
 	"github.com/keepsea/goddns/ddns_client/util"
 )
 
-type keyViewRequest struct {
-	SecretToken string `json:"secret_token"`
-}
-
-type keyResetRequest struct {
+type keyRequest struct {
 	SecretToken      string `json:"secret_token"`
-	NewEncryptionKey string `json:"new_encryption_key"`
+	Action           string `json:"action"`
+	NewEncryptionKey string `json:"new_encryption_key,omitempty"`
+	TOTPCode         string `json:"totp_code,omitempty"`
 }
 
 func RunViewKey() {
 	log.Println("正在向服务端查询您的加密密钥...")
-	req, err := http.NewRequest(http.MethodGet, config.App.ServerURL+"/manage-key?username="+config.App.Username, nil)
-	if err != nil {
-		log.Fatalf("错误: 创建请求失败: %v", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+config.App.SecretToken)
-	body, err := api.SendRequest(req)
+	body, err := api.SendSecureRequest("/manage-key", http.MethodPost, keyRequest{SecretToken: config.App.SecretToken, Action: "view"})
 	if err != nil {
 		log.Fatalf("错误: %v", err)
 	}
@@ -44,23 +37,56 @@ func RunViewKey() {
 	fmt.Printf("您当前的加密密钥是: %s\n", resp.EncryptionKey)
 }
 
+// RunResetKey 以两阶段方式轮换加密密钥：
+// 1. 使用旧密钥向服务端登记新密钥 (rotate)，宽限期内新旧密钥均有效；
+// 2. 将新密钥写入 config.ini，写入失败时使用旧密钥放弃轮换 (abort)；
+// 3. 使用新密钥确认 (commit)，旧密钥随即作废。
 func RunResetKey() {
 	log.Println("正在为您生成新的加密密钥...")
 	newKey, err := util.GenerateRandomKey()
 	if err != nil {
 		log.Fatalf("错误: 生成新密钥失败: %v", err)
 	}
-	log.Printf("新密钥已生成。准备向服务端请求更新...")
-	payload := keyResetRequest{
-		SecretToken:      config.App.SecretToken,
-		NewEncryptionKey: newKey,
-	}
-	_, err = api.SendSecureRequest("/manage-key", http.MethodPost, payload)
+	log.Printf("新密钥已生成。准备向服务端登记...")
+	body, err := sendWithTOTP("/manage-key", http.MethodPost, func(totpCode string) interface{} {
+		return keyRequest{
+			SecretToken:      config.App.SecretToken,
+			Action:           "rotate",
+			NewEncryptionKey: newKey,
+			TOTPCode:         totpCode,
+		}
+	})
 	if err != nil {
-		log.Fatalf("错误: 重置密钥失败: %v", err)
+		log.Fatalf("错误: 登记新密钥失败，当前密钥保持不变: %v", err)
+	}
+	var resp struct {
+		ExpiresAt string `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		log.Fatalf("错误: 解析服务端响应失败: %v", err)
 	}
+
 	if err := config.SaveKey(newKey); err != nil {
-		log.Fatalf("成功重置密钥，但无法自动更新config.ini文件: %v\n请手动将新密钥写入文件:\n%s", err, newKey)
+		log.Printf("错误: 无法将新密钥写入config.ini: %v", err)
+		if _, abortErr := api.SendSecureRequest("/manage-key", http.MethodPost, keyRequest{SecretToken: config.App.SecretToken, Action: "abort"}); abortErr != nil {
+			log.Fatalf("放弃密钥轮换也失败了: %v\n旧密钥将于 %s 过期，请在此之前手动将新密钥写入config.ini:\n%s", abortErr, resp.ExpiresAt, newKey)
+		}
+		log.Fatalf("已放弃本次密钥轮换，当前密钥保持不变。")
+	}
+
+	if _, err := api.SendSecureRequest("/manage-key", http.MethodPost, keyRequest{SecretToken: config.App.SecretToken, Action: "commit"}); err != nil {
+		log.Printf("警告: 新密钥已保存，但确认失败: %v", err)
+		log.Printf("客户端下一次请求时轮换会自动提交；旧密钥最迟于 %s 过期。", resp.ExpiresAt)
+		return
 	}
 	log.Println("成功: 您的加密密钥已重置，并且config.ini文件已自动更新！")
 }
+
+// RunAbortKeyRotation 放弃进行中的密钥轮换，继续使用 config.ini 中的当前密钥。
+func RunAbortKeyRotation() {
+	_, err := api.SendSecureRequest("/manage-key", http.MethodPost, keyRequest{SecretToken: config.App.SecretToken, Action: "abort"})
+	if err != nil {
+		log.Fatalf("错误: %v", err)
+	}
+	log.Println("成功: 密钥轮换已放弃，继续使用当前密钥。")
+}
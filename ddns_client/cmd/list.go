@@ -16,28 +16,40 @@ import (
 
 func RunList() {
 	log.Println("正在向服务端查询已注册的域名列表...")
-	req, err := http.NewRequest(http.MethodGet, config.App.ServerURL+"/manage-records?username="+config.App.Username, nil)
-	if err != nil {
-		log.Fatalf("错误: 创建请求失败: %v", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+config.App.SecretToken)
-	body, err := api.SendRequest(req)
+	body, err := api.SendSecureRequest("/manage-records", http.MethodPost, manageRequest{SecretToken: config.App.SecretToken})
 	if err != nil {
 		log.Fatalf("错误: %v", err)
 	}
-	var records []struct {
-		DomainName string `json:"domain_name"`
-		RR         string `json:"rr"`
+	var resp struct {
+		Records []struct {
+			DomainName     string `json:"domain_name"`
+			RR             string `json:"rr"`
+			Line           string `json:"line"`
+			Paused         bool   `json:"paused"`
+			HasUpdateToken bool   `json:"has_update_token"`
+		} `json:"records"`
 	}
-	if err := json.Unmarshal(body, &records); err != nil {
+	if err := json.Unmarshal(body, &resp); err != nil {
 		log.Fatalf("错误: 解析服务端响应失败: %v", err)
 	}
+	records := resp.Records
 	if len(records) == 0 {
 		log.Println("您名下当前没有注册任何域名。")
 		return
 	}
 	log.Println("您已注册的域名如下:")
 	for _, r := range records {
-		fmt.Printf("- %s.%s\n", r.RR, r.DomainName)
+		line := r.Line
+		if line == "" {
+			line = "default"
+		}
+		status := ""
+		if r.Paused {
+			status += " (已暂停)"
+		}
+		if r.HasUpdateToken {
+			status += " (已生成更新令牌)"
+		}
+		fmt.Printf("- %s.%s [线路: %s]%s\n", r.RR, r.DomainName, line, status)
 	}
 }
@@ -0,0 +1,62 @@
+// ===================================================================================
+// File: ddns-client/cmd/recordtoken.go
+// Description: 负责执行 'record-token' 和 'revoke-record-token' 命令，为单条记录生成或吊销专属更新令牌，供无法运行本客户端的设备使用。
+// ===================================================================================
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/keepsea/goddns/ddns_client/api"
+	"github.com/keepsea/goddns/ddns_client/config"
+)
+
+type recordTokenRequest struct {
+	SecretToken string `json:"secret_token"`
+	DomainName  string `json:"domain_name"`
+	RR          string `json:"rr"`
+	Line        string `json:"line,omitempty"`
+	Action      string `json:"action"`
+}
+
+// RunRecordToken 为域名生成 (revoke=false) 或吊销一个专属更新令牌。
+func RunRecordToken(fullDomain, line string, revoke bool) {
+	parts := strings.SplitN(fullDomain, ".", 2)
+	if len(parts) < 2 {
+		log.Fatalf("域名格式错误。请输入完整域名，例如 'home.example.com'")
+	}
+	action := "create"
+	if revoke {
+		action = "revoke"
+	}
+	payload := recordTokenRequest{
+		SecretToken: config.App.SecretToken,
+		DomainName:  parts[1],
+		RR:          parts[0],
+		Line:        line,
+		Action:      action,
+	}
+	body, err := api.SendSecureRequest("/record-token", http.MethodPost, payload)
+	if err != nil {
+		log.Fatalf("错误: %v", err)
+	}
+	if revoke {
+		log.Printf("成功: 域名 %s 的更新令牌已吊销。", fullDomain)
+		return
+	}
+	var resp struct {
+		Token string `json:"token"`
+		Path  string `json:"path"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		log.Fatalf("错误: 解析服务端响应失败: %v", err)
+	}
+	log.Printf("成功: 已为 %s 生成新的更新令牌 (旧令牌立即失效)。令牌只显示这一次，请妥善保存:", fullDomain)
+	fmt.Printf("%s\n", resp.Token)
+	log.Println("设备可使用以下地址更新IP (省略 ip 参数时使用请求的来源地址):")
+	fmt.Printf("%s%s?ip=1.2.3.4\n", config.App.ServerURL, resp.Path)
+}
@@ -9,29 +9,34 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/keepsea/goddns/ddns_client/api"
 	"github.com/keepsea/goddns/ddns_client/config"
 )
 
 type manageRequest struct {
 	SecretToken string `json:"secret_token"`
-	DomainName  string `json:"domain_name"`
-	RR          string `json:"rr"`
+	DomainName  string `json:"domain_name,omitempty"`
+	RR          string `json:"rr,omitempty"`
+	Line        string `json:"line,omitempty"`
+	TOTPCode    string `json:"totp_code,omitempty"`
 }
 
-func RunRemove(fullDomain string) {
+// RunRemove 注销一个域名。line 为空时注销该域名在所有解析线路上的记录。
+func RunRemove(fullDomain, line string) {
 	log.Printf("准备向服务端请求注销域名: %s", fullDomain)
 	parts := strings.SplitN(fullDomain, ".", 2)
 	if len(parts) < 2 {
 		log.Fatalf("域名格式错误。请输入完整域名，例如 'home.example.com'")
 	}
 	rr, domainName := parts[0], parts[1]
-	payload := manageRequest{
-		SecretToken: config.App.SecretToken,
-		DomainName:  domainName,
-		RR:          rr,
-	}
-	body, err := api.SendSecureRequest("/manage-records", http.MethodDelete, payload)
+	body, err := sendWithTOTP("/manage-records", http.MethodDelete, func(totpCode string) interface{} {
+		return manageRequest{
+			SecretToken: config.App.SecretToken,
+			DomainName:  domainName,
+			RR:          rr,
+			Line:        line,
+			TOTPCode:    totpCode,
+		}
+	})
 	if err != nil {
 		log.Fatalf("错误: %v", err)
 	}
@@ -0,0 +1,47 @@
+// ===================================================================================
+// File: ddns-client/cmd/status.go
+// Description: 负责执行 'pause' 和 'resume' 命令，暂停/恢复域名解析但保留域名所有权。
+// ===================================================================================
+package cmd
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/keepsea/goddns/ddns_client/api"
+	"github.com/keepsea/goddns/ddns_client/config"
+)
+
+type statusRequest struct {
+	SecretToken string `json:"secret_token"`
+	DomainName  string `json:"domain_name"`
+	RR          string `json:"rr"`
+	Line        string `json:"line,omitempty"`
+	Action      string `json:"action"`
+}
+
+// RunSetStatus 暂停 (pause=true) 或恢复一个域名的解析。line 为空时作用于所有解析线路。
+func RunSetStatus(fullDomain, line string, pause bool) {
+	action := "resume"
+	if pause {
+		action = "pause"
+	}
+	log.Printf("准备向服务端请求 %s 域名: %s", action, fullDomain)
+	parts := strings.SplitN(fullDomain, ".", 2)
+	if len(parts) < 2 {
+		log.Fatalf("域名格式错误。请输入完整域名，例如 'home.example.com'")
+	}
+	payload := statusRequest{
+		SecretToken: config.App.SecretToken,
+		DomainName:  parts[1],
+		RR:          parts[0],
+		Line:        line,
+		Action:      action,
+	}
+	body, err := api.SendSecureRequest("/record-status", http.MethodPost, payload)
+	if err != nil {
+		log.Fatalf("错误: %v", err)
+	}
+	log.Printf("成功: 服务端响应: %s", string(body))
+}
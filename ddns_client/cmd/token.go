@@ -0,0 +1,64 @@
+// ===================================================================================
+// File: ddns-client/cmd/token.go
+// Description: 负责执行 'rotate-token' 命令，在本地生成新的 secret_token 并与服务端完成两阶段轮换，流程与 'reset-key' 相同。
+// ===================================================================================
+package cmd
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/keepsea/goddns/ddns_client/api"
+	"github.com/keepsea/goddns/ddns_client/config"
+	"github.com/keepsea/goddns/ddns_client/util"
+)
+
+type tokenRequest struct {
+	SecretToken    string `json:"secret_token"`
+	Action         string `json:"action"`
+	NewSecretToken string `json:"new_secret_token,omitempty"`
+}
+
+// RunRotateToken 以两阶段方式轮换 secret_token：登记新令牌 (rotate)，写入 config.ini，再携带新令牌确认 (commit)。
+// 写入 config.ini 失败时使用旧令牌放弃轮换 (abort)。
+func RunRotateToken() {
+	newToken, err := util.GenerateSecretToken()
+	if err != nil {
+		log.Fatalf("错误: 生成新令牌失败: %v", err)
+	}
+	log.Println("新令牌已生成。准备向服务端登记...")
+	body, err := api.SendSecureRequest("/manage-token", http.MethodPost, tokenRequest{SecretToken: config.App.SecretToken, Action: "rotate", NewSecretToken: newToken})
+	if err != nil {
+		log.Fatalf("错误: 登记新令牌失败，当前令牌保持不变: %v", err)
+	}
+	var resp struct {
+		ExpiresAt string `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		log.Fatalf("错误: 解析服务端响应失败: %v", err)
+	}
+
+	if err := config.SaveToken(newToken); err != nil {
+		log.Printf("错误: 无法将新令牌写入config.ini: %v", err)
+		if _, abortErr := api.SendSecureRequest("/manage-token", http.MethodPost, tokenRequest{SecretToken: config.App.SecretToken, Action: "abort"}); abortErr != nil {
+			log.Fatalf("放弃令牌轮换也失败了: %v\n旧令牌将于 %s 过期，请在此之前手动将新令牌写入config.ini:\n%s", abortErr, resp.ExpiresAt, newToken)
+		}
+		log.Fatalf("已放弃本次令牌轮换，当前令牌保持不变。")
+	}
+
+	if _, err := api.SendSecureRequest("/manage-token", http.MethodPost, tokenRequest{SecretToken: config.App.SecretToken, Action: "commit"}); err != nil {
+		log.Printf("警告: 新令牌已保存，但确认失败: %v", err)
+		log.Printf("客户端下一次使用新令牌请求时轮换会自动提交；旧令牌最迟于 %s 过期。", resp.ExpiresAt)
+		return
+	}
+	log.Println("成功: 您的 secret_token 已轮换，并且config.ini文件已自动更新！使用同一令牌的其他设备和路由器请同步更新。")
+}
+
+// RunAbortTokenRotation 放弃进行中的令牌轮换，继续使用 config.ini 中的当前令牌。
+func RunAbortTokenRotation() {
+	if _, err := api.SendSecureRequest("/manage-token", http.MethodPost, tokenRequest{SecretToken: config.App.SecretToken, Action: "abort"}); err != nil {
+		log.Fatalf("错误: %v", err)
+	}
+	log.Println("成功: 令牌轮换已放弃，继续使用当前令牌。")
+}
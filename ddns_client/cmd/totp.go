@@ -0,0 +1,79 @@
+// ===================================================================================
+// File: ddns-client/cmd/totp.go
+// Description: 负责执行 'enroll-totp' 和 'disable-totp' 命令，并提供 sendWithTOTP：
+// 服务端要求 TOTP 验证码 (totp_required) 时提示用户输入，然后带上验证码重新发送请求。
+// ===================================================================================
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/keepsea/goddns/ddns_client/api"
+	"github.com/keepsea/goddns/ddns_client/config"
+)
+
+type totpRequest struct {
+	SecretToken string `json:"secret_token"`
+	Action      string `json:"action"`
+	TOTPCode    string `json:"totp_code,omitempty"`
+}
+
+// promptTOTP 从标准输入读取 6 位验证码。
+func promptTOTP() string {
+	fmt.Print("请输入验证器 App 中显示的 6 位 TOTP 验证码: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatalf("错误: 读取验证码失败: %v", err)
+	}
+	return strings.TrimSpace(line)
+}
+
+// sendWithTOTP 发送 build("") 构造的请求；服务端要求 TOTP 时提示输入验证码，并以 build(code) 重新发送。
+func sendWithTOTP(endpoint, method string, build func(totpCode string) interface{}) ([]byte, error) {
+	body, err := api.SendSecureRequest(endpoint, method, build(""))
+	var serverErr *api.ServerError
+	if errors.As(err, &serverErr) && serverErr.Code == "totp_required" {
+		return api.SendSecureRequest(endpoint, method, build(promptTOTP()))
+	}
+	return body, err
+}
+
+// RunEnrollTOTP 登记 TOTP：输出 otpauth:// 地址，待用户添加到验证器 App 后输入验证码确认。
+func RunEnrollTOTP() {
+	body, err := api.SendSecureRequest("/manage-totp", http.MethodPost, totpRequest{SecretToken: config.App.SecretToken, Action: "enroll"})
+	if err != nil {
+		log.Fatalf("错误: %v", err)
+	}
+	var resp struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		log.Fatalf("错误: 解析服务端响应失败: %v", err)
+	}
+	log.Println("请将以下地址添加到验证器 App（可用任意工具转换为二维码扫描），或手动输入密钥:")
+	fmt.Println(resp.URI)
+	fmt.Printf("密钥: %s\n", resp.Secret)
+
+	code := promptTOTP()
+	if _, err := api.SendSecureRequest("/manage-totp", http.MethodPost, totpRequest{SecretToken: config.App.SecretToken, Action: "confirm", TOTPCode: code}); err != nil {
+		log.Fatalf("错误: 确认 TOTP 失败: %v", err)
+	}
+	log.Println("成功: TOTP 二次验证已启用。之后注销域名和重置密钥都需要输入验证码。")
+}
+
+// RunDisableTOTP 在验证当前验证码后停用 TOTP。
+func RunDisableTOTP() {
+	code := promptTOTP()
+	if _, err := api.SendSecureRequest("/manage-totp", http.MethodPost, totpRequest{SecretToken: config.App.SecretToken, Action: "disable", TOTPCode: code}); err != nil {
+		log.Fatalf("错误: 停用 TOTP 失败: %v", err)
+	}
+	log.Println("成功: TOTP 二次验证已停用。")
+}
@@ -18,13 +18,14 @@ type updateRequest struct {
 	SecretToken string `json:"secret_token"`
 	DomainName  string `json:"domain_name"`
 	RR          string `json:"rr"`
-	NewIP       string `json:"new_ip"`
+	Line        string `json:"line,omitempty"`
+	NewIP       string `json:"new_ip,omitempty"`
 }
 
 func RunUpdateDaemon() {
 	log.SetFlags(log.Ldate | log.Ltime)
 	log.Println("DDNS 客户端 (V2.2) [更新模式] 启动...")
-	log.Printf("配置加载成功: 用户名=%s, 服务端地址=%s, 目标域名=%s.%s, 检查间隔=%v", config.App.Username, config.App.ServerURL, config.App.RR, config.App.DomainName, time.Duration(config.App.CheckIntervalSeconds)*time.Second)
+	log.Printf("配置加载成功: 用户名=%s, 服务端地址=%s, 目标域名=%s.%s, 解析线路=%s, 检查间隔=%v", config.App.Username, config.App.ServerURL, config.App.RR, config.App.DomainName, config.App.Line, time.Duration(config.App.CheckIntervalSeconds)*time.Second)
 
 	checkAndSendUpdate()
 
@@ -37,7 +38,13 @@ func RunUpdateDaemon() {
 
 func checkAndSendUpdate() {
 	log.Println("开始检查公网 IP...")
-	currentIP, err := util.GetPublicIP()
+	var currentIP string
+	var err error
+	if config.App.IPSource == "server" {
+		currentIP, err = queryServerIP()
+	} else {
+		currentIP, err = util.GetPublicIP()
+	}
 	if err != nil {
 		log.Printf("错误: 获取公网 IP 失败: %v", err)
 		return
@@ -55,8 +62,13 @@ func checkAndSendUpdate() {
 			SecretToken: config.App.SecretToken,
 			DomainName:  config.App.DomainName,
 			RR:          config.App.RR,
+			Line:        config.App.Line,
 			NewIP:       currentIP,
 		}
+		if config.App.IPSource == "server" {
+			// 由服务端直接使用本次请求的来源地址
+			payload.NewIP = ""
+		}
 		body, err := api.SendSecureRequest("/update-dns", http.MethodPost, payload)
 		if err != nil {
 			log.Printf("失败: %v", err)
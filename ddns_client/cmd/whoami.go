@@ -0,0 +1,57 @@
+// ===================================================================================
+// File: ddns-client/cmd/whoami.go
+// Description: 负责执行 'whoami' 命令，并提供 queryServerIP 供更新守护进程在 ip_source = server 时向服务端查询公网IP。
+// ===================================================================================
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/keepsea/goddns/ddns_client/api"
+	"github.com/keepsea/goddns/ddns_client/config"
+)
+
+type whoAmIRequest struct {
+	SecretToken string `json:"secret_token"`
+}
+
+type whoAmIResponse struct {
+	IP     string `json:"ip"`
+	Family string `json:"family"`
+}
+
+func queryWhoAmI() (*whoAmIResponse, error) {
+	body, err := api.SendSecureRequest("/whoami", http.MethodPost, whoAmIRequest{SecretToken: config.App.SecretToken})
+	if err != nil {
+		return nil, err
+	}
+	var resp whoAmIResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析服务端响应失败: %w", err)
+	}
+	return &resp, nil
+}
+
+// queryServerIP 返回服务端观察到的本机IPv4公网地址。
+func queryServerIP() (string, error) {
+	resp, err := queryWhoAmI()
+	if err != nil {
+		return "", err
+	}
+	if resp.Family != "ipv4" {
+		return "", fmt.Errorf("服务端观察到的来源地址 %s 不是IPv4地址", resp.IP)
+	}
+	return resp.IP, nil
+}
+
+func RunWhoAmI() {
+	log.Println("正在向服务端查询本机的来源地址...")
+	resp, err := queryWhoAmI()
+	if err != nil {
+		log.Fatalf("错误: %v", err)
+	}
+	fmt.Printf("服务端观察到的来源地址: %s (%s)\n", resp.IP, resp.Family)
+}
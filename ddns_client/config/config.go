@@ -12,13 +12,24 @@ import (
 
 var App AppConfig
 
+// DefaultDeviceKeyFile 是未配置 device_key_file 时设备私钥的保存路径。
+const DefaultDeviceKeyFile = "device.key"
+
 type AppConfig struct {
 	ServerURL            string
 	Username             string
 	SecretToken          string
 	EncryptionKey        string
+	CAFile               string
+	CertFingerprint      string
+	ClientCert           string
+	ClientKey            string
+	DeviceName           string
+	DeviceKeyFile        string
 	DomainName           string
 	RR                   string
+	Line                 string
+	IPSource             string
 	CheckIntervalSeconds int
 }
 
@@ -33,15 +44,27 @@ func Load(isUpdateDaemon bool) error {
 	App.Username = clientSection.Key("username").String()
 	App.SecretToken = clientSection.Key("secret_token").String()
 	App.EncryptionKey = clientSection.Key("encryption_key").String()
+	App.CAFile = clientSection.Key("ca_file").String()
+	App.CertFingerprint = clientSection.Key("cert_fingerprint").String()
+	App.ClientCert = clientSection.Key("client_cert").String()
+	App.ClientKey = clientSection.Key("client_key").String()
+	App.DeviceName = clientSection.Key("device_name").String()
+	App.DeviceKeyFile = clientSection.Key("device_key_file").MustString(DefaultDeviceKeyFile)
 
-	if App.ServerURL == "" || App.Username == "" || App.SecretToken == "" || App.EncryptionKey == "" {
-		return fmt.Errorf("config.ini 中缺少核心配置项 (server_url, username, secret_token, encryption_key)")
+	if (App.ClientCert == "") != (App.ClientKey == "") {
+		return fmt.Errorf("config.ini 中的 client_cert 和 client_key 必须同时配置")
+	}
+	// 使用客户端证书 (mTLS) 或已登记的设备密钥认证时可以不配置 secret_token。
+	if App.ServerURL == "" || App.Username == "" || (App.SecretToken == "" && App.ClientCert == "" && App.DeviceName == "") || App.EncryptionKey == "" {
+		return fmt.Errorf("config.ini 中缺少核心配置项 (server_url, username, secret_token/client_cert/device_name, encryption_key)")
 	}
 
 	if isUpdateDaemon {
 		App.DomainName = clientSection.Key("domain_name").String()
 		App.RR = clientSection.Key("rr").String()
+		App.Line = clientSection.Key("line").MustString("default")
 		App.CheckIntervalSeconds = clientSection.Key("check_interval_seconds").MustInt(300)
+		App.IPSource = clientSection.Key("ip_source").In("public", []string{"public", "server"})
 		if App.DomainName == "" || App.RR == "" {
 			return fmt.Errorf("config.ini 中缺少 domain_name 或 rr 配置项")
 		}
@@ -55,6 +78,40 @@ func SaveKey(newKey string) error {
 		return fmt.Errorf("无法加载config.ini以更新密钥: %w", err)
 	}
 	cfg.Section("client").Key("encryption_key").SetValue(newKey)
+	if err := cfg.SaveTo("config.ini"); err != nil {
+		return err
+	}
 	App.EncryptionKey = newKey
+	return nil
+}
+
+// SaveToken 将新的 secret_token 写入 config.ini，写入成功后才更新内存中的配置。
+func SaveToken(newToken string) error {
+	cfg, err := ini.Load("config.ini")
+	if err != nil {
+		return fmt.Errorf("无法加载config.ini以更新令牌: %w", err)
+	}
+	cfg.Section("client").Key("secret_token").SetValue(newToken)
+	if err := cfg.SaveTo("config.ini"); err != nil {
+		return err
+	}
+	App.SecretToken = newToken
+	return nil
+}
+
+// SaveDevice 将设备名和私钥路径写入 config.ini。name 为空时清除设备配置。
+func SaveDevice(name, keyFile string) error {
+	cfg, err := ini.Load("config.ini")
+	if err != nil {
+		return fmt.Errorf("无法加载config.ini以更新设备配置: %w", err)
+	}
+	section := cfg.Section("client")
+	if name == "" {
+		section.DeleteKey("device_name")
+	} else {
+		section.Key("device_name").SetValue(name)
+		section.Key("device_key_file").SetValue(keyFile)
+	}
+	App.DeviceName = name
 	return cfg.SaveTo("config.ini")
 }
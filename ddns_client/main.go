@@ -20,8 +20,28 @@ func main() {
 	updateFlag := flag.Bool("update", false, "启动后台守护进程，持续更新IP地址 (默认操作)。")
 	listFlag := flag.Bool("list", false, "查询并列出当前用户已注册的所有域名。")
 	removeFlag := flag.String("remove", "", "注销一个已注册的域名。用法: -remove <rr.domain.com>")
+	pauseFlag := flag.String("pause", "", "暂停一个域名的解析（维护模式），域名仍保留在您名下。用法: -pause <rr.domain.com>")
+	resumeFlag := flag.String("resume", "", "恢复一个已暂停域名的解析。用法: -resume <rr.domain.com>")
+	recordTokenFlag := flag.String("record-token", "", "为一个域名生成专属更新令牌，供路由器、摄像头等设备通过 /u/<token> 更新。用法: -record-token <rr.domain.com>")
+	revokeRecordTokenFlag := flag.String("revoke-record-token", "", "吊销一个域名的专属更新令牌。用法: -revoke-record-token <rr.domain.com>")
+	lineFlag := flag.String("line", "", "配合 -remove/-pause/-resume/-record-token/-create-token 使用，仅作用于指定解析线路 (default, telecom, unicom, mobile, oversea) 的记录。")
+	whoamiFlag := flag.Bool("whoami", false, "查询服务端观察到的本机公网地址。")
 	viewKeyFlag := flag.Bool("view-key", false, "查询并显示您当前的加密密钥。")
-	resetKeyFlag := flag.Bool("reset-key", false, "生成一个新密钥并向服务端请求重置。")
+	resetKeyFlag := flag.Bool("reset-key", false, "生成一个新密钥并向服务端请求重置。新旧密钥在宽限期内均有效，新密钥保存成功后才会生效。")
+	abortKeyRotationFlag := flag.Bool("abort-key-rotation", false, "放弃服务端上进行中的密钥轮换，继续使用 config.ini 中的当前密钥。")
+	rotateTokenFlag := flag.Bool("rotate-token", false, "生成一个新的 secret_token 并向服务端登记。新旧令牌在宽限期内均有效，新令牌保存成功后才会生效。")
+	abortTokenRotationFlag := flag.Bool("abort-token-rotation", false, "放弃服务端上进行中的令牌轮换，继续使用 config.ini 中的当前令牌。")
+	createTokenFlag := flag.String("create-token", "", "签发一个带权限范围的 API 令牌。用法: -create-token <令牌名> [-scope update|read|full] [-token-record <rr.domain.com>] [-line <线路>] [-expires-days <天数>]")
+	scopeFlag := flag.String("scope", "update", "配合 -create-token 使用，令牌的权限范围: update (只能更新记录)、read (只能查询)、full (完整权限)。")
+	tokenRecordFlag := flag.String("token-record", "", "配合 -create-token 使用，将 update 令牌限定为只能更新这一条记录。")
+	expiresDaysFlag := flag.Int("expires-days", 0, "配合 -create-token 使用，令牌的有效天数，0 表示永不过期。")
+	listTokensFlag := flag.Bool("list-tokens", false, "列出已签发的所有 API 令牌。")
+	revokeTokenFlag := flag.String("revoke-token", "", "吊销一个 API 令牌。用法: -revoke-token <令牌名>")
+	enrollTOTPFlag := flag.Bool("enroll-totp", false, "启用 TOTP 二次验证。启用后注销域名和重置密钥都需要输入验证器 App 中的验证码。")
+	disableTOTPFlag := flag.Bool("disable-totp", false, "停用 TOTP 二次验证（需要输入当前验证码）。")
+	enrollDeviceFlag := flag.String("enroll-device", "", "为本机生成设备密钥并登记，之后请求由设备密钥签名，无需 secret_token。用法: -enroll-device <设备名>")
+	listDevicesFlag := flag.Bool("list-devices", false, "列出当前用户已登记的所有设备。")
+	revokeDeviceFlag := flag.String("revoke-device", "", "吊销一台已登记的设备，不影响其他设备。用法: -revoke-device <设备名>")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "goddns-client: 一个多功能DDNS客户端工具。\n\n")
@@ -44,7 +64,32 @@ func main() {
 		if err := config.Load(false); err != nil {
 			log.Fatalf("错误: %v", err)
 		}
-		cmd.RunRemove(*removeFlag)
+		cmd.RunRemove(*removeFlag, *lineFlag)
+	} else if *pauseFlag != "" {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunSetStatus(*pauseFlag, *lineFlag, true)
+	} else if *resumeFlag != "" {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunSetStatus(*resumeFlag, *lineFlag, false)
+	} else if *recordTokenFlag != "" {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunRecordToken(*recordTokenFlag, *lineFlag, false)
+	} else if *revokeRecordTokenFlag != "" {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunRecordToken(*revokeRecordTokenFlag, *lineFlag, true)
+	} else if *whoamiFlag {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunWhoAmI()
 	} else if *viewKeyFlag {
 		if err := config.Load(false); err != nil {
 			log.Fatalf("错误: %v", err)
@@ -55,6 +100,61 @@ func main() {
 			log.Fatalf("错误: %v", err)
 		}
 		cmd.RunResetKey()
+	} else if *abortKeyRotationFlag {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunAbortKeyRotation()
+	} else if *rotateTokenFlag {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunRotateToken()
+	} else if *abortTokenRotationFlag {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunAbortTokenRotation()
+	} else if *createTokenFlag != "" {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunCreateToken(*createTokenFlag, *scopeFlag, *tokenRecordFlag, *lineFlag, *expiresDaysFlag)
+	} else if *listTokensFlag {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunListTokens()
+	} else if *revokeTokenFlag != "" {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunRevokeToken(*revokeTokenFlag)
+	} else if *enrollTOTPFlag {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunEnrollTOTP()
+	} else if *disableTOTPFlag {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunDisableTOTP()
+	} else if *enrollDeviceFlag != "" {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunEnrollDevice(*enrollDeviceFlag)
+	} else if *listDevicesFlag {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunListDevices()
+	} else if *revokeDeviceFlag != "" {
+		if err := config.Load(false); err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		cmd.RunRevokeDevice(*revokeDeviceFlag)
 	} else {
 		*updateFlag = true
 		if err := config.Load(true); err != nil {
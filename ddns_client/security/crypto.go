@@ -13,8 +13,8 @@ import (
 	"io"
 )
 
-// Encrypt 使用 AES-GCM 加密数据。
-func Encrypt(key, plaintext []byte) (string, error) {
+// Encrypt 使用 AES-GCM 加密数据，additionalData 作为附加认证数据参与校验（见 envelope.go）。
+func Encrypt(key, plaintext, additionalData []byte) (string, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
@@ -27,12 +27,12 @@ func Encrypt(key, plaintext []byte) (string, error) {
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
 	}
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, additionalData)
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
 // Decrypt 使用 AES-GCM 解密数据 (客户端主要用于解密服务端返回的加密信息，如密钥)。
-func Decrypt(key []byte, ciphertext string) ([]byte, error) {
+func Decrypt(key []byte, ciphertext string, additionalData []byte) ([]byte, error) {
 	data, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
 		return nil, err
@@ -49,7 +49,7 @@ func Decrypt(key []byte, ciphertext string) ([]byte, error) {
 		return nil, fmt.Errorf("密文过短")
 	}
 	nonce, encryptedMessage := data[:gcm.NonceSize()], data[gcm.NonceSize():]
-	plaintext, err := gcm.Open(nil, nonce, encryptedMessage, nil)
+	plaintext, err := gcm.Open(nil, nonce, encryptedMessage, additionalData)
 	if err != nil {
 		return nil, err
 	}
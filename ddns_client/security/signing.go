@@ -0,0 +1,75 @@
+// ===================================================================================
+// File: ddns-client/security/signing.go
+// Description: 管理本机的设备密钥 (Ed25519)。私钥以 PKCS#8 PEM 格式保存在本地文件中，只有公钥会发送给服务端登记。
+// ===================================================================================
+package security
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// GenerateDeviceKey 生成新的设备私钥，并以 0600 权限写入 path。path 已存在时拒绝覆盖。
+func GenerateDeviceKey(path string) (ed25519.PrivateKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("无法创建设备私钥文件 %s: %w", path, err)
+	}
+	defer file.Close()
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return nil, fmt.Errorf("写入设备私钥文件失败: %w", err)
+	}
+	return privateKey, nil
+}
+
+// LoadDeviceKey 读取 PEM 格式的设备私钥。
+func LoadDeviceKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取设备私钥文件 %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("设备私钥文件 %s 格式错误", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析设备私钥失败: %w", err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("设备私钥文件 %s 不是 Ed25519 私钥", path)
+	}
+	return privateKey, nil
+}
+
+// EncodePublicKey 返回设备公钥的 base64 编码，用于向服务端登记。
+func EncodePublicKey(privateKey ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey))
+}
+
+// PublicKeyFingerprint 返回设备公钥 SHA-256 摘要的前 16 位十六进制，与服务端 -list-devices 的输出一致。
+func PublicKeyFingerprint(privateKey ed25519.PrivateKey) string {
+	sum := sha256.Sum256(privateKey.Public().(ed25519.PublicKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign 对 message 签名，返回 base64 编码的签名。
+func Sign(privateKey ed25519.PrivateKey, message []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, message))
+}
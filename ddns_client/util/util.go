@@ -52,3 +52,12 @@ func GenerateRandomKey() (string, error) {
 	}
 	return base64.StdEncoding.EncodeToString(key), nil
 }
+
+// GenerateSecretToken 生成一个强随机的 secret_token (32 字节随机数的 base64url 编码，43 个字符)。
+func GenerateSecretToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
@@ -0,0 +1,67 @@
+// ===================================================================================
+// File: ddns-server/admin.go
+// Description: 管理员命令行操作。这些操作在服务启动前执行，完成后直接退出，不会启动 Web 服务。
+// - runImportRecord: 将阿里云上已存在、未被 goddns 管理的记录显式导入并绑定给指定用户。
+// ===================================================================================
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/keepsea/goddns/ddns_server/aliyun"
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// runImportRecord 解析 "<username>:<rr.domain.com>" 形式的参数，导入解析线路 line 上的记录。
+func runImportRecord(arg, line string) error {
+	username, fullDomain, ok := strings.Cut(arg, ":")
+	if !ok {
+		return fmt.Errorf("参数格式错误，应为 <username>:<rr.domain.com>")
+	}
+	rr, domainName, ok := strings.Cut(fullDomain, ".")
+	if !ok {
+		return fmt.Errorf("域名格式错误。请输入完整域名，例如 'home.example.com'")
+	}
+	if err := security.ValidateUsername(username); err != nil {
+		return err
+	}
+	if err := security.ValidateDomain(domainName); err != nil {
+		return err
+	}
+	if err := security.ValidateRR(rr); err != nil {
+		return err
+	}
+	if err := security.ValidateLine(line); err != nil {
+		return err
+	}
+	if _, ok := config.GetUserByKeyLookup(username); !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	// 本地的域名策略、冲突和额度检查必须先于写入所有权标记，失败时阿里云上的记录保持原样
+	if err := config.CheckZoneAccess(username, domainName, rr); err != nil {
+		return err
+	}
+	if err := config.CheckRecordBindable(username, domainName, rr); err != nil {
+		return err
+	}
+
+	client, err := aliyun.CreateClient()
+	if err != nil {
+		return fmt.Errorf("创建阿里云客户端失败: %w", err)
+	}
+	recordID, previousRemark, err := aliyun.ImportDomainRecord(client, domainName, rr, line, username)
+	if err != nil {
+		return err
+	}
+	if err := config.BindRecordToUser(username, domainName, rr, line, recordID); err != nil {
+		if restoreErr := aliyun.RestoreRecordRemark(client, recordID, previousRemark); restoreErr != nil {
+			log.Printf("严重警告: 撤销记录 %s 的所有权标记失败，请在控制台手动恢复备注 '%s': %v", recordID, previousRemark, restoreErr)
+		}
+		return fmt.Errorf("绑定到用户失败，已撤销所有权标记: %w", err)
+	}
+	log.Printf("成功: 记录 %s.%s (线路: %s, RecordID: %s) 已导入并绑定给用户 '%s'。", rr, domainName, line, recordID, username)
+	return nil
+}
@@ -3,16 +3,24 @@
 // Description: 封装所有与阿里云云解析DNS (Alidns) API 的直接交互。
 // 功能:
 // - 提供 CreateClient() 函数，用于创建与阿里云通信的客户端实例。
-// - 实现 GetOrCreateDomainRecord()，封装了“查找或创建A记录”的原子操作。
+// - 实现 GetOrCreateDomainRecord()，封装了“查找或创建A记录”的原子操作，并拒绝接管非 goddns 创建或属于其他用户的记录。
+// - 记录查找为精确匹配并遍历所有分页，发现重复记录时只自动清理调用者自己的多余记录。
+// - 实现 ImportDomainRecord()，供管理员显式将已有记录纳入 goddns 管理。
+// - 所有由 goddns 创建或导入的记录都会在备注 (Remark) 中写入所有权标记。
 // - 实现 UpdateRecordValue()，用于更新已有记录的IP地址。
+// - 所有记录操作都带有解析线路 (Line) 参数，支持按运营商线路发布不同的地址。
 // - 实现 DeleteDomainRecord()，用于删除指定的A记录。
+// - 实现 SetRecordStatus()，用于暂停/恢复记录解析（不删除记录）。
 // - 这个模块的存在，使得如果未来想支持其他DNS服务商（如腾讯云DNSPod），我们只需要新增一个类似的模块即可，而无需改动核心业务逻辑。
 //
 // ===================================================================================
 package aliyun
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 
 	alidns20150109 "github.com/alibabacloud-go/alidns-20150109/v4/client"
 	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
@@ -20,6 +28,25 @@ import (
 	"github.com/aliyun/credentials-go/credentials"
 )
 
+// ManagedRemarkPrefix 是 goddns 写入记录备注中的所有权标记前缀，完整备注为 "goddns:<username>"。
+const ManagedRemarkPrefix = "goddns:"
+
+// ErrUnmanagedRecord 表示阿里云上已存在一条未带 goddns 标记的同名记录。
+var ErrUnmanagedRecord = errors.New("阿里云上已存在一条非 goddns 管理的同名记录，拒绝接管 (如确需使用请联系管理员导入)")
+
+// ErrForeignRecord 表示阿里云上的同名记录带有其他 goddns 用户的所有权标记。
+var ErrForeignRecord = errors.New("阿里云上的同名记录属于其他 goddns 用户，拒绝接管")
+
+func isManagedRecord(record *domainRecord) bool {
+	return record.Remark != nil && strings.HasPrefix(*record.Remark, ManagedRemarkPrefix)
+}
+
+func tagRecord(client *alidns20150109.Client, recordId, owner string) error {
+	req := &alidns20150109.UpdateDomainRecordRemarkRequest{RecordId: tea.String(recordId), Remark: tea.String(ManagedRemarkPrefix + owner)}
+	_, err := client.UpdateDomainRecordRemark(req)
+	return err
+}
+
 func CreateClient() (*alidns20150109.Client, error) {
 	cred, err := credentials.NewCredential(nil)
 	if err != nil {
@@ -28,48 +55,189 @@ func CreateClient() (*alidns20150109.Client, error) {
 	config := &openapi.Config{Credential: cred, Endpoint: tea.String("dns.aliyuncs.com")}
 	return alidns20150109.NewClient(config)
 }
-func getDomainRecordInternal(client *alidns20150109.Client, domainName, rr string) (*alidns20150109.DescribeDomainRecordsResponseBodyDomainRecordsRecord, error) {
-	req := &alidns20150109.DescribeDomainRecordsRequest{DomainName: tea.String(domainName), RRKeyWord: tea.String(rr), Type: tea.String("A")}
-	resp, err := client.DescribeDomainRecords(req)
-	if err != nil {
-		return nil, err
+
+// recordPageSize 是分页查询解析记录时的每页条数（阿里云允许的最大值）。
+const recordPageSize = 500
+
+type domainRecord = alidns20150109.DescribeDomainRecordsResponseBodyDomainRecordsRecord
+
+// findDomainRecords 精确查找 domainName 下主机记录为 rr、解析线路为 line 的所有A记录。
+// 查询会遍历所有分页，并在本地再次按 RR/类型/线路做精确比对，避免模糊匹配（如 home、home2、myhome）导致漏查。
+func findDomainRecords(client *alidns20150109.Client, domainName, rr, line string) ([]*domainRecord, error) {
+	var matches []*domainRecord
+	for page := int64(1); ; page++ {
+		req := &alidns20150109.DescribeDomainRecordsRequest{
+			DomainName: tea.String(domainName),
+			KeyWord:    tea.String(rr),
+			SearchMode: tea.String("EXACT"),
+			Type:       tea.String("A"),
+			Line:       tea.String(line),
+			PageNumber: tea.Int64(page),
+			PageSize:   tea.Int64(recordPageSize),
+		}
+		resp, err := client.DescribeDomainRecords(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Body == nil || resp.Body.DomainRecords == nil {
+			break
+		}
+		records := resp.Body.DomainRecords.Record
+		for _, record := range records {
+			if strings.EqualFold(tea.StringValue(record.RR), rr) && tea.StringValue(record.Type) == "A" && tea.StringValue(record.Line) == line {
+				matches = append(matches, record)
+			}
+		}
+		if len(records) < recordPageSize || page*recordPageSize >= tea.Int64Value(resp.Body.TotalCount) {
+			break
+		}
+	}
+	return matches, nil
+}
+
+// resolveDuplicateRecords 在同名同线路存在多条A记录时选出要保留的一条，并删除其余带有 owner 标记的重复记录。
+// 保留优先级: RecordID 等于 knownRecordID 的记录 > 最早创建的 owner 记录。
+// 只有 owner 自己的重复记录会被删除；存在非 goddns 创建或属于其他用户的重复记录时返回 ErrUnmanagedRecord / ErrForeignRecord，
+// 不删除任何记录，需要管理员在阿里云控制台手动处理。
+func resolveDuplicateRecords(client *alidns20150109.Client, records []*domainRecord, owner, knownRecordID string) (*domainRecord, error) {
+	ownerRemark := ManagedRemarkPrefix + owner
+	isOwned := func(record *domainRecord) bool {
+		return tea.StringValue(record.Remark) == ownerRemark
+	}
+	var keep *domainRecord
+	for _, record := range records {
+		if knownRecordID != "" && tea.StringValue(record.RecordId) == knownRecordID {
+			keep = record
+			break
+		}
 	}
-	for _, record := range resp.Body.DomainRecords.Record {
-		if *record.RR == rr {
-			return record, nil
+	if keep == nil {
+		for _, record := range records {
+			if isOwned(record) && (keep == nil || tea.Int64Value(record.CreateTimestamp) < tea.Int64Value(keep.CreateTimestamp)) {
+				keep = record
+			}
 		}
 	}
-	return nil, nil
+	for _, record := range records {
+		if record == keep || isOwned(record) {
+			continue
+		}
+		log.Printf("警告: %s.%s 存在不属于用户 '%s' 的重复记录 %s (备注: '%s')，无法自动清理。", tea.StringValue(record.RR), tea.StringValue(record.DomainName), owner, tea.StringValue(record.RecordId), tea.StringValue(record.Remark))
+		if isManagedRecord(record) {
+			return nil, ErrForeignRecord
+		}
+		return nil, ErrUnmanagedRecord
+	}
+	for _, record := range records {
+		if record == keep {
+			continue
+		}
+		if err := DeleteDomainRecord(client, tea.StringValue(record.RecordId)); err != nil {
+			return nil, fmt.Errorf("清理重复记录 %s 失败: %w", tea.StringValue(record.RecordId), err)
+		}
+		log.Printf("已清理重复记录: %s.%s (RecordID: %s)，保留 %s", tea.StringValue(record.RR), tea.StringValue(record.DomainName), tea.StringValue(record.RecordId), tea.StringValue(keep.RecordId))
+	}
+	return keep, nil
 }
-func addDomainRecord(client *alidns20150109.Client, domainName, rr, ip string) (*string, error) {
-	req := &alidns20150109.AddDomainRecordRequest{DomainName: tea.String(domainName), RR: tea.String(rr), Type: tea.String("A"), Value: tea.String(ip)}
+
+func addDomainRecord(client *alidns20150109.Client, domainName, rr, line, ip string) (*string, error) {
+	req := &alidns20150109.AddDomainRecordRequest{DomainName: tea.String(domainName), RR: tea.String(rr), Type: tea.String("A"), Line: tea.String(line), Value: tea.String(ip)}
 	resp, err := client.AddDomainRecord(req)
 	if err != nil {
 		return nil, err
 	}
 	return resp.Body.RecordId, nil
 }
-func UpdateRecordValue(client *alidns20150109.Client, recordId, rr, newIP string) error {
-	req := &alidns20150109.UpdateDomainRecordRequest{RecordId: tea.String(recordId), RR: tea.String(rr), Type: tea.String("A"), Value: tea.String(newIP)}
+func UpdateRecordValue(client *alidns20150109.Client, recordId, rr, line, newIP string) error {
+	req := &alidns20150109.UpdateDomainRecordRequest{RecordId: tea.String(recordId), RR: tea.String(rr), Type: tea.String("A"), Line: tea.String(line), Value: tea.String(newIP)}
 	_, err := client.UpdateDomainRecord(req)
 	return err
 }
-func GetOrCreateDomainRecord(client *alidns20150109.Client, domainName, rr, ip string) (string, string, error) {
-	record, err := getDomainRecordInternal(client, domainName, rr)
+
+// GetOrCreateDomainRecord 查找或创建 owner 在解析线路 line 上的A记录，返回 RecordID、当前IP以及记录是否为本次新建。
+// 已存在但未带 goddns 标记的记录只有在其 RecordID 等于 knownRecordID（即用户早已绑定的旧记录）时才会被接管并补打标记，
+// 否则返回 ErrUnmanagedRecord；带有其他用户标记的记录返回 ErrForeignRecord，其备注不会被修改。
+// 调用前必须先通过本地的所有权检查 (config.CheckRecordBindable)，避免在检查失败时改动阿里云上的记录。
+func GetOrCreateDomainRecord(client *alidns20150109.Client, domainName, rr, line, ip, owner, knownRecordID string) (string, string, bool, error) {
+	records, err := findDomainRecords(client, domainName, rr, line)
 	if err != nil {
-		return "", "", fmt.Errorf("查找域名记录时出错: %w", err)
+		return "", "", false, fmt.Errorf("查找域名记录时出错: %w", err)
+	}
+	var record *domainRecord
+	if len(records) > 1 {
+		if record, err = resolveDuplicateRecords(client, records, owner, knownRecordID); err != nil {
+			return "", "", false, err
+		}
+	} else if len(records) == 1 {
+		record = records[0]
 	}
 	if record == nil {
-		recordId, err := addDomainRecord(client, domainName, rr, ip)
+		recordId, err := addDomainRecord(client, domainName, rr, line, ip)
 		if err != nil {
-			return "", "", fmt.Errorf("创建新域名记录时出错: %w", err)
+			return "", "", false, fmt.Errorf("创建新域名记录时出错: %w", err)
 		}
-		return *recordId, ip, nil
+		if err := tagRecord(client, *recordId, owner); err != nil {
+			if delErr := DeleteDomainRecord(client, *recordId); delErr != nil {
+				return "", "", false, fmt.Errorf("为新记录写入所有权标记失败 (%v)，且回滚删除失败: %w", err, delErr)
+			}
+			return "", "", false, fmt.Errorf("为新记录写入所有权标记失败: %w", err)
+		}
+		return *recordId, ip, true, nil
+	}
+	if !isManagedRecord(record) {
+		if knownRecordID == "" || *record.RecordId != knownRecordID {
+			return "", "", false, ErrUnmanagedRecord
+		}
+		if err := tagRecord(client, *record.RecordId, owner); err != nil {
+			return "", "", false, fmt.Errorf("为已绑定的旧记录补写所有权标记失败: %w", err)
+		}
+	} else if *record.Remark != ManagedRemarkPrefix+owner {
+		log.Printf("拒绝: %s.%s (RecordID: %s) 的所有权标记为 '%s'，不属于用户 '%s'", rr, domainName, *record.RecordId, *record.Remark, owner)
+		return "", "", false, ErrForeignRecord
 	}
-	return *record.RecordId, *record.Value, nil
+	return *record.RecordId, *record.Value, false, nil
 }
+
+// ImportDomainRecord 由管理员调用，将阿里云上已存在的记录打上 owner 的所有权标记，返回其 RecordID 和原来的备注，
+// 后续绑定失败时可以用 RestoreRecordRemark 撤销标记。
+func ImportDomainRecord(client *alidns20150109.Client, domainName, rr, line, owner string) (string, string, error) {
+	records, err := findDomainRecords(client, domainName, rr, line)
+	if err != nil {
+		return "", "", fmt.Errorf("查找域名记录时出错: %w", err)
+	}
+	if len(records) == 0 {
+		return "", "", fmt.Errorf("阿里云上不存在记录 %s.%s (线路: %s)", rr, domainName, line)
+	}
+	if len(records) > 1 {
+		return "", "", fmt.Errorf("阿里云上存在 %d 条重复的 %s.%s 记录 (线路: %s)，请先在控制台清理后再导入", len(records), rr, domainName, line)
+	}
+	record := records[0]
+	if err := tagRecord(client, *record.RecordId, owner); err != nil {
+		return "", "", fmt.Errorf("写入所有权标记失败: %w", err)
+	}
+	return *record.RecordId, tea.StringValue(record.Remark), nil
+}
+
+// RestoreRecordRemark 将记录的备注恢复为 remark，用于撤销导入时写入的所有权标记。
+func RestoreRecordRemark(client *alidns20150109.Client, recordId, remark string) error {
+	req := &alidns20150109.UpdateDomainRecordRemarkRequest{RecordId: tea.String(recordId), Remark: tea.String(remark)}
+	_, err := client.UpdateDomainRecordRemark(req)
+	return err
+}
+
 func DeleteDomainRecord(client *alidns20150109.Client, recordId string) error {
 	req := &alidns20150109.DeleteDomainRecordRequest{RecordId: tea.String(recordId)}
 	_, err := client.DeleteDomainRecord(req)
 	return err
 }
+
+// SetRecordStatus 启用或暂停一条记录的解析，暂停后记录仍保留在阿里云上但不再生效。
+func SetRecordStatus(client *alidns20150109.Client, recordId string, enabled bool) error {
+	status := "Disable"
+	if enabled {
+		status = "Enable"
+	}
+	req := &alidns20150109.SetDomainRecordStatusRequest{RecordId: tea.String(recordId), Status: tea.String(status)}
+	_, err := client.SetDomainRecordStatus(req)
+	return err
+}
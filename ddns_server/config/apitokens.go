@@ -0,0 +1,145 @@
+// ===================================================================================
+// File: ddns-server/config/apitokens.go
+// Description: 管理用户自行签发的带权限范围的 API 令牌。
+// - 令牌格式为 "gdt_<id>.<secret>"，服务端只保存 id 和 secret 的 SHA-256 摘要，明文只在签发时返回一次。
+// - 权限范围 (scope): update 只能更新记录（可限定到某一条记录），read 只能查询，full 与 secret_token 等同。
+// - 令牌可以设置过期时间，过期后自动失效。
+// ===================================================================================
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scope 是凭据的权限范围。
+type Scope string
+
+const (
+	// ScopeAny 表示接口对权限范围没有要求，任何有效凭据都可以访问。
+	ScopeAny    Scope = ""
+	ScopeUpdate Scope = "update"
+	ScopeRead   Scope = "read"
+	ScopeFull   Scope = "full"
+)
+
+// APITokenPrefix 是 API 令牌的固定前缀，用于与 secret_token 区分。
+const APITokenPrefix = "gdt_"
+
+// MaxAPITokensPerUser 限制每个用户可签发的 API 令牌数量。
+const MaxAPITokensPerUser = 20
+
+// APIToken 是用户签发的一个 API 令牌。Record/Line 仅对 update 范围有效，留空表示不限记录/线路。
+// update 范围的令牌只能更新已注册的记录，不能创建新记录。
+type APIToken struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Scope      Scope  `json:"scope"`
+	Record     string `json:"record,omitempty"`
+	Line       string `json:"line,omitempty"`
+	SecretHash string `json:"secret_hash"`
+	CreatedAt  string `json:"created_at"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+	// SourcePolicy 由管理员在 users.json 中配置，限制该令牌的更新请求，见 source.go。
+	SourcePolicy
+}
+
+// ValidScope 判断 scope 是否为可签发的权限范围。
+func ValidScope(scope Scope) bool {
+	return scope == ScopeUpdate || scope == ScopeRead || scope == ScopeFull
+}
+
+// Allows 判断权限范围 granted 是否满足接口要求的 required。
+func (granted Scope) Allows(required Scope) bool {
+	return required == ScopeAny || granted == ScopeFull || granted == required
+}
+
+// Expired 判断令牌在 now 时是否已过期。到期时间无法解析时按已过期处理。
+func (t APIToken) Expired(now time.Time) bool {
+	if t.ExpiresAt == "" {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, t.ExpiresAt)
+	return err != nil || !now.Before(expiresAt)
+}
+
+// AllowsRecord 判断令牌是否可以操作指定记录。line 为空表示默认线路。
+func (t APIToken) AllowsRecord(domainName, rr, line string) bool {
+	if t.Record != "" && !strings.EqualFold(t.Record, rr+"."+domainName) {
+		return false
+	}
+	if line == "" {
+		line = DefaultLine
+	}
+	return t.Line == "" || t.Line == line
+}
+
+// SplitAPIToken 拆分 "gdt_<id>.<secret>" 格式的令牌。不是 API 令牌格式时 ok 为 false。
+func SplitAPIToken(token string) (id, secret string, ok bool) {
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(strings.TrimPrefix(token, APITokenPrefix), ".")
+	if !ok || id == "" || secret == "" {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+// FindAPIToken 返回用户名下指定 id 的令牌。
+func (u User) FindAPIToken(id string) (APIToken, bool) {
+	for _, token := range u.APITokens {
+		if token.ID == id {
+			return token, true
+		}
+	}
+	return APIToken{}, false
+}
+
+// AddAPIToken 为用户登记一个新令牌。令牌名在用户内必须唯一，已过期的令牌会被顺带清理。
+func AddAPIToken(username string, token APIToken) error {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	now := time.Now()
+	tokens := make([]APIToken, 0, len(user.APITokens)+1)
+	for _, existing := range user.APITokens {
+		if existing.Expired(now) {
+			continue
+		}
+		if existing.Name == token.Name {
+			return fmt.Errorf("令牌 '%s' 已存在，请先吊销或换一个名称", token.Name)
+		}
+		tokens = append(tokens, existing)
+	}
+	if len(tokens) >= MaxAPITokensPerUser {
+		return fmt.Errorf("令牌数量已达上限 (%d)", MaxAPITokensPerUser)
+	}
+	user.APITokens = append(tokens, token)
+	return saveUsersToFile()
+}
+
+// RemoveAPIToken 按名称吊销用户名下的令牌。
+func RemoveAPIToken(username, name string) error {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	tokens := make([]APIToken, 0, len(user.APITokens))
+	for _, token := range user.APITokens {
+		if token.Name != name {
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == len(user.APITokens) {
+		return fmt.Errorf("用户 '%s' 名下未找到令牌 '%s'", username, name)
+	}
+	user.APITokens = tokens
+	return saveUsersToFile()
+}
@@ -3,55 +3,142 @@
 // Description:  项目的数据和配置管理中心。
 // 功能:
 // - 定义 User, DomainRecord 等核心数据结构。
-// - 从 server.ini 加载服务自身配置（如端口号）。
+// - 从 server.ini 加载服务自身配置（如端口号、受信任代理、时钟偏差、速率限制、托管域名、保留主机记录）。
 // - 从 users.json 加载、解析所有用户信息，并将其存入一个易于查询的map中。
-// - 提供线程安全的函数（如 GetUserByKeyLookup, BindRecordToUser, UnbindRecordFromUser, UpdateUserKey）来增、删、改、查用户数据。
+// - 提供线程安全的函数（如 GetUserByKeyLookup, GetUserRecord, BindRecordToUser, FindRecordByUpdateToken, UnbindRecordFromUser）来增、删、改、查用户数据。
 // - 在用户注册新域名时，进行额度检查和全局域名冲突检查。
-// - 负责将更新后的用户数据写回 users.json 文件，实现数据持久化。
+// - 负责将更新后的用户数据写回 users.json 文件，实现数据持久化。令牌以哈希形式保存，加密密钥在配置主密钥后以封装形式保存（见 secrets.go）。
 //
 // ===================================================================================
 package config
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/keepsea/goddns/ddns_server/security"
 	"gopkg.in/ini.v1"
 )
 
 var (
-	ServerPort string
+	ServerPort     string
+	TLSCertFile    string
+	TLSKeyFile     string
+	TLSMinVersion  string
+	ClientCAFile   string
+	ClientCRLFile  string
+	TLSReload      = 30 * time.Second
+	RedirectPort   string
+	MaxClockSkew   = 5 * time.Minute
+	RotationGrace  = 24 * time.Hour
+	MasterKeyFile  string
+	AdminToken     string
+	ClientIPSource string
+	GeoIPCountryDB string
+	GeoIPASNDB     string
+	GeoIPAlertLog  string
+	TrustedProxies []string
+	ManagedZones   []string
+	ReservedRRs    []string
+	// AllowedIPClasses 是全局允许写入记录的地址类别，ZoneIPClasses 按主域名覆盖，见 policy.go。
+	AllowedIPClasses []string
+	ZoneIPClasses    map[string][]string
 )
 
+// 暴力破解防护: 连续 LockoutThreshold 次认证失败后锁定，锁定时长从 LockoutBase 开始翻倍，最长 LockoutMax。
+var (
+	LockoutThreshold = 5
+	LockoutBase      = time.Minute
+	LockoutMax       = time.Hour
+)
+
+// defaultTrustedProxies 在 server.ini 未配置 trusted_proxies 时生效，即只信任本机上的反向代理（如 Nginx）。
+var defaultTrustedProxies = []string{"127.0.0.0/8", "::1/128"}
+
 const (
 	ServerConfigFile = "server.ini"
 	UsersConfigFile  = "users.json"
 )
 
+// DefaultLine 是阿里云的默认解析线路，旧版 users.json 中未填写 line 的记录均视为默认线路。
+const DefaultLine = "default"
+
 type DomainRecord struct {
 	DomainName string `json:"domain_name"`
 	RR         string `json:"rr"`
+	Line       string `json:"line,omitempty"`
 	RecordID   string `json:"record_id"`
+	Paused     bool   `json:"paused,omitempty"`
+	// UpdateTokenHash 是该记录专属更新令牌的 SHA-256 摘要，持有令牌即可通过 /u/<token> 更新这一条记录。
+	UpdateTokenHash string `json:"update_token_hash,omitempty"`
+	// History 是该记录最近的更新历史，见 history.go。
+	History []RecordEvent `json:"history,omitempty"`
+}
+
+// EffectiveLine 返回记录的解析线路，未填写时为默认线路。
+func (r DomainRecord) EffectiveLine() string {
+	if r.Line == "" {
+		return DefaultLine
+	}
+	return r.Line
 }
 
 type User struct {
-	Username      string         `json:"username"`
-	SecretToken   string         `json:"secret_token"`
-	EncryptionKey string         `json:"encryption_key"`
-	DomainLimit   int            `json:"domain_limit"`
-	Records       []DomainRecord `json:"records"`
+	Username string `json:"username"`
+	// SecretToken 仅用于读取旧版/管理员新填写的明文令牌，加载时会迁移为 SecretTokenHash 并清空。
+	SecretToken     string `json:"secret_token,omitempty"`
+	SecretTokenHash string `json:"secret_token_hash,omitempty"`
+	// PendingSecretTokenHash 是轮换中的新令牌哈希，轮换期间新旧令牌均可使用，见 rotation.go。
+	PendingSecretTokenHash string `json:"pending_secret_token_hash,omitempty"`
+	PendingTokenExpiresAt  string `json:"pending_token_expires_at,omitempty"`
+	// EncryptionKey 是运行时使用的明文密钥，不直接序列化；落盘时写入 SealedEncryptionKey（或在未配置主密钥时写入 PlainEncryptionKey）。
+	EncryptionKey       string `json:"-"`
+	PlainEncryptionKey  string `json:"encryption_key,omitempty"`
+	SealedEncryptionKey string `json:"sealed_encryption_key,omitempty"`
+	// PendingEncryptionKey 是轮换中的新密钥（运行时明文），轮换期间新旧密钥均可使用，见 rotation.go。
+	PendingEncryptionKey       string `json:"-"`
+	PendingPlainEncryptionKey  string `json:"pending_encryption_key,omitempty"`
+	PendingSealedEncryptionKey string `json:"pending_sealed_encryption_key,omitempty"`
+	PendingKeyExpiresAt        string `json:"pending_key_expires_at,omitempty"`
+	// CertNames 是可代表该用户的客户端证书名称 (CN 或 SAN)。配置后该用户可通过 mTLS 认证，secret_token 可以省略。
+	CertNames []string   `json:"cert_names,omitempty"`
+	Devices   []Device   `json:"devices,omitempty"`
+	APITokens []APIToken `json:"api_tokens,omitempty"`
+	// TOTPSecret 是运行时明文的 TOTP 密钥，落盘形式与加密密钥相同，见 secrets.go 和 totp.go。
+	TOTPSecret       string         `json:"-"`
+	TOTPPlainSecret  string         `json:"totp_secret,omitempty"`
+	TOTPSealedSecret string         `json:"sealed_totp_secret,omitempty"`
+	TOTPLastCounter  int64          `json:"totp_last_counter,omitempty"`
+	DomainLimit      int            `json:"domain_limit"`
+	AllowedZones     []string       `json:"allowed_zones,omitempty"`
+	Records          []DomainRecord `json:"records"`
+	// SourcePolicy 限制该用户的更新请求来自哪些网络、可以写入哪些地址，见 source.go。
+	SourcePolicy
+
+	// sealedKeySource 记录 SealedEncryptionKey 当前对应的明文密钥，避免每次保存都重新封装。
+	sealedKeySource        string
+	pendingSealedKeySource string
+	totpSealedSource       string
+	// pendingTOTPSecret 是尚未确认的 TOTP 密钥，只保存在内存中。
+	pendingTOTPSecret string
 }
 
+// UserConfig 是 users.json 的顶层结构。用户条目逐条解析，被跳过的条目需要原样保留。
 type UserConfig struct {
-	Users []*User `json:"users"`
+	Users []json.RawMessage `json:"users"`
 }
 
 var (
 	userMap      map[string]*User
 	userMapMutex = &sync.RWMutex{}
+	// skippedUsers 是加载时因配置不完整而跳过的用户条目，保存时原样写回，避免管理员的配置被删除。
+	skippedUsers []json.RawMessage
 )
 
 func LoadServerConfig() error {
@@ -60,12 +147,114 @@ func LoadServerConfig() error {
 		if os.IsNotExist(err) {
 			log.Printf("警告: 找不到 %s，将使用默认端口 9876。", ServerConfigFile)
 			ServerPort = "9876"
+			TrustedProxies = defaultTrustedProxies
+			ClientIPSource = security.ClientIPFromXForwardedFor
+			ReservedRRs = defaultReservedRRs
+			AllowedIPClasses = defaultIPClasses
+			log.Printf("警告: 未配置任何托管域名 (managed_zones)，所有域名操作都将被拒绝。")
 			return nil
 		}
 		return fmt.Errorf("无法加载服务端配置文件 %s: %w", ServerConfigFile, err)
 	}
 	serverSection := cfg.Section("server")
 	ServerPort = serverSection.Key("listen_port").MustString("9876")
+	if serverSection.HasKey("trusted_proxies") {
+		TrustedProxies = serverSection.Key("trusted_proxies").Strings(",")
+	} else {
+		TrustedProxies = defaultTrustedProxies
+	}
+	ClientIPSource = strings.ToLower(strings.TrimSpace(serverSection.Key("client_ip_source").MustString(security.ClientIPFromXForwardedFor)))
+	if err := security.ValidateClientIPSource(ClientIPSource); err != nil {
+		return err
+	}
+
+	tlsSection := cfg.Section("tls")
+	TLSCertFile = tlsSection.Key("tls_cert").String()
+	TLSKeyFile = tlsSection.Key("tls_key").String()
+	TLSMinVersion = tlsSection.Key("min_version").In("1.2", []string{"1.2", "1.3"})
+	reloadSeconds := tlsSection.Key("reload_interval_seconds").MustInt(30)
+	if reloadSeconds <= 0 {
+		return fmt.Errorf("reload_interval_seconds 必须大于 0，当前为 %d", reloadSeconds)
+	}
+	TLSReload = time.Duration(reloadSeconds) * time.Second
+	RedirectPort = tlsSection.Key("http_redirect_port").String()
+	ClientCAFile = tlsSection.Key("client_ca_file").String()
+	ClientCRLFile = tlsSection.Key("client_crl_file").String()
+	if ClientCRLFile != "" && ClientCAFile == "" {
+		return fmt.Errorf("client_crl_file 需要同时配置 client_ca_file")
+	}
+	if ClientCAFile != "" && TLSCertFile == "" {
+		return fmt.Errorf("client_ca_file 仅在启用 TLS (tls_cert/tls_key) 时有效")
+	}
+	if (TLSCertFile == "") != (TLSKeyFile == "") {
+		return fmt.Errorf("[tls] 段的 tls_cert 和 tls_key 必须同时配置")
+	}
+	if TLSCertFile == "" {
+		log.Printf("警告: 未配置 TLS 证书 (tls_cert/tls_key)，服务将以明文 HTTP 提供。生产环境请启用 TLS 或置于 HTTPS 反向代理之后。")
+		if RedirectPort != "" {
+			return fmt.Errorf("http_redirect_port 仅在启用 TLS 时有效")
+		}
+	}
+
+	securitySection := cfg.Section("security")
+	MaxClockSkew = time.Duration(securitySection.Key("max_clock_skew_seconds").MustInt(300)) * time.Second
+	if MaxClockSkew <= 0 {
+		return fmt.Errorf("max_clock_skew_seconds 必须大于 0，当前为 %d", securitySection.Key("max_clock_skew_seconds").MustInt(300))
+	}
+	RotationGrace = time.Duration(securitySection.Key("rotation_grace_seconds").MustInt(86400)) * time.Second
+	if RotationGrace <= 0 {
+		return fmt.Errorf("rotation_grace_seconds 必须大于 0，当前为 %d", securitySection.Key("rotation_grace_seconds").MustInt(86400))
+	}
+	MasterKeyFile = securitySection.Key("master_key_file").String()
+	AdminToken = securitySection.Key("admin_token").String()
+	LockoutThreshold = securitySection.Key("lockout_threshold").MustInt(5)
+	LockoutBase = time.Duration(securitySection.Key("lockout_base_seconds").MustInt(60)) * time.Second
+	LockoutMax = time.Duration(securitySection.Key("lockout_max_seconds").MustInt(3600)) * time.Second
+	if LockoutBase <= 0 || LockoutMax < LockoutBase {
+		return fmt.Errorf("lockout_base_seconds 必须大于 0 且不大于 lockout_max_seconds")
+	}
+	if AdminToken != "" && len(AdminToken) < 24 {
+		return fmt.Errorf("admin_token 长度不能少于 24 个字符")
+	}
+
+	geoSection := cfg.Section("geoip")
+	GeoIPCountryDB = geoSection.Key("country_db").String()
+	GeoIPASNDB = geoSection.Key("asn_db").String()
+	GeoIPAlertLog = geoSection.Key("alert_log").String()
+
+	if err := loadRateLimits(cfg); err != nil {
+		return err
+	}
+
+	dnsSection := cfg.Section("dns")
+	ManagedZones = normalizeNames(dnsSection.Key("managed_zones").Strings(","))
+	if dnsSection.HasKey("reserved_rrs") {
+		ReservedRRs = normalizeNames(dnsSection.Key("reserved_rrs").Strings(","))
+	} else {
+		ReservedRRs = defaultReservedRRs
+	}
+	AllowedIPClasses = defaultIPClasses
+	if dnsSection.HasKey("allowed_ip_classes") {
+		if AllowedIPClasses, err = security.ValidateIPClasses(dnsSection.Key("allowed_ip_classes").Strings(",")); err != nil {
+			return fmt.Errorf("[dns] 段的 allowed_ip_classes 配置无效: %w", err)
+		}
+	}
+	ZoneIPClasses = make(map[string][]string)
+	for _, key := range cfg.Section("dns.ip_classes").Keys() {
+		zone := strings.TrimSuffix(strings.ToLower(key.Name()), ".")
+		if !containsName(ManagedZones, zone) {
+			return fmt.Errorf("[dns.ip_classes] 段的主域名 %s 不在 managed_zones 中", key.Name())
+		}
+		if ZoneIPClasses[zone], err = security.ValidateIPClasses(key.Strings(",")); err != nil {
+			return fmt.Errorf("[dns.ip_classes] 段的主域名 %s 配置无效: %w", key.Name(), err)
+		}
+	}
+
+	if len(ManagedZones) == 0 {
+		log.Printf("警告: 未配置任何托管域名 (managed_zones)，所有域名操作都将被拒绝。")
+	} else {
+		log.Printf("托管域名: %s", strings.Join(ManagedZones, ", "))
+	}
 	return nil
 }
 
@@ -91,26 +280,59 @@ func LoadUsers() error {
 	}
 
 	userMap = make(map[string]*User)
+	skippedUsers = nil
 	domainRegistry := make(map[string]string)
+	certRegistry := make(map[string]string)
+	migrated := 0
 
-	for _, user := range userConfig.Users {
-		if user.Username == "" || user.SecretToken == "" || len(user.EncryptionKey) != 32 {
-			log.Printf("警告: 用户 '%s' 的配置不完整或encryption_key长度不为32，已跳过。", user.Username)
+	for _, entry := range userConfig.Users {
+		user := &User{}
+		if err := json.Unmarshal(entry, user); err != nil {
+			return fmt.Errorf("解析用户配置文件JSON失败: %w", err)
+		}
+		changed, err := loadUserSecrets(user)
+		if err != nil {
+			return fmt.Errorf("加载用户 '%s' 的凭据失败: %w", user.Username, err)
+		}
+		user.CertNames = normalizeNames(user.CertNames)
+		if user.Username == "" || (user.SecretTokenHash == "" && len(user.CertNames) == 0 && len(user.Devices) == 0) || len(user.EncryptionKey) != 32 {
+			log.Printf("警告: 用户 '%s' 的配置不完整或encryption_key长度不为32，已跳过（该条目会原样保留在 %s 中）。", user.Username, UsersConfigFile)
+			skippedUsers = append(skippedUsers, entry)
 			continue
 		}
+		if finishExpiredRotations(user, time.Now()) {
+			changed = true
+		}
+		if changed {
+			migrated++
+		}
 		if user.DomainLimit <= 0 {
 			user.DomainLimit = 1
 		}
+		user.AllowedZones = normalizeNames(user.AllowedZones)
+		if err := user.validateSourcePolicies(); err != nil {
+			return fmt.Errorf("用户 '%s' 的 %w", user.Username, err)
+		}
 		userMap[user.Username] = user
 		for _, record := range user.Records {
 			fullDomain := fmt.Sprintf("%s.%s", record.RR, record.DomainName)
-			if owner, exists := domainRegistry[fullDomain]; exists {
+			if owner, exists := domainRegistry[fullDomain]; exists && owner != user.Username {
 				return fmt.Errorf("域名冲突: %s 已被用户 '%s' 注册", fullDomain, owner)
 			}
 			domainRegistry[fullDomain] = user.Username
 		}
+		for _, name := range user.CertNames {
+			if owner, exists := certRegistry[name]; exists && owner != user.Username {
+				return fmt.Errorf("证书名称冲突: %s 同时映射到用户 '%s' 和 '%s'", name, owner, user.Username)
+			}
+			certRegistry[name] = user.Username
+		}
 	}
 	log.Printf("成功加载 %d 个用户配置。", len(userMap))
+	if migrated > 0 {
+		log.Printf("已更新 %d 个用户的凭据（迁移明文凭据或完成已到期的轮换），正在写回 %s。", migrated, UsersConfigFile)
+		return saveUsersToFile()
+	}
 	return nil
 }
 
@@ -121,10 +343,48 @@ func GetUserByKeyLookup(username string) (User, bool) {
 	if !ok {
 		return User{}, false
 	}
-	return *user, true
+	return user.clone(), true
+}
+
+// clone 返回用户的深拷贝。Records、APITokens 和 Devices 会在运行时被修改，
+// 返回给调用方的副本不能与 userMap 共享底层数组，否则持锁外的读取会与写入产生数据竞争。
+// CertNames、AllowedZones 和 SourcePolicy 只在加载时设置，可以共享。调用方需持有 userMapMutex。
+func (u *User) clone() User {
+	c := *u
+	c.Records = make([]DomainRecord, len(u.Records))
+	for i, record := range u.Records {
+		c.Records[i] = record.clone()
+	}
+	c.APITokens = append([]APIToken(nil), u.APITokens...)
+	c.Devices = append([]Device(nil), u.Devices...)
+	return c
+}
+
+// clone 返回记录的深拷贝，History 不与原记录共享。
+func (r DomainRecord) clone() DomainRecord {
+	r.History = append([]RecordEvent(nil), r.History...)
+	return r
 }
 
-func BindRecordToUser(username, domainName, rr, recordID string) error {
+// GetUserRecord 返回用户名下已绑定的指定域名在解析线路 line 上的记录。
+func GetUserRecord(username, domainName, rr, line string) (DomainRecord, bool) {
+	userMapMutex.RLock()
+	defer userMapMutex.RUnlock()
+	user, ok := userMap[username]
+	if !ok {
+		return DomainRecord{}, false
+	}
+	for _, record := range user.Records {
+		if record.DomainName == domainName && record.RR == rr && record.EffectiveLine() == line {
+			return record.clone(), true
+		}
+	}
+	return DomainRecord{}, false
+}
+
+// BindRecordToUser 将记录绑定到用户。同一主机记录的不同解析线路只占用一个域名额度，
+// 且同一主机记录的所有线路只能归属于同一个用户。
+func BindRecordToUser(username, domainName, rr, line, recordID string) error {
 	userMapMutex.Lock()
 	defer userMapMutex.Unlock()
 	user, ok := userMap[username]
@@ -132,17 +392,43 @@ func BindRecordToUser(username, domainName, rr, recordID string) error {
 		return fmt.Errorf("找不到用户 '%s' 无法绑定记录", username)
 	}
 	for i := range user.Records {
-		if user.Records[i].DomainName == domainName && user.Records[i].RR == rr {
+		if user.Records[i].DomainName == domainName && user.Records[i].RR == rr && user.Records[i].EffectiveLine() == line {
 			user.Records[i].RecordID = recordID
 			return saveUsersToFile()
 		}
 	}
-	if len(user.Records) >= user.DomainLimit {
-		return fmt.Errorf("域名数量达到上限 (%d)，无法为用户 '%s' 添加新域名", user.DomainLimit, username)
+	if err := checkBindable(user, domainName, rr); err != nil {
+		return err
+	}
+	user.Records = append(user.Records, DomainRecord{DomainName: domainName, RR: rr, Line: line, RecordID: recordID})
+	return saveUsersToFile()
+}
+
+// CheckRecordBindable 在调用阿里云之前检查记录能否绑定到用户: 同名记录未被其他用户占用，且新域名不超出额度。
+// 用户已绑定该主机记录（任一线路）时总是通过。
+func CheckRecordBindable(username, domainName, rr string) error {
+	userMapMutex.RLock()
+	defer userMapMutex.RUnlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s' 无法绑定记录", username)
+	}
+	return checkBindable(user, domainName, rr)
+}
+
+// checkBindable 是 CheckRecordBindable 和 BindRecordToUser 共用的检查，调用方需持有 userMapMutex。
+func checkBindable(user *User, domainName, rr string) error {
+	for _, r := range user.Records {
+		if r.DomainName == domainName && r.RR == rr {
+			return nil
+		}
+	}
+	if countDistinctNames(user.Records) >= user.DomainLimit {
+		return fmt.Errorf("域名数量达到上限 (%d)，无法为用户 '%s' 添加新域名", user.DomainLimit, user.Username)
 	}
 	fullDomain := fmt.Sprintf("%s.%s", rr, domainName)
 	for _, u := range userMap {
-		if u.Username == username {
+		if u.Username == user.Username {
 			continue
 		}
 		for _, r := range u.Records {
@@ -151,55 +437,130 @@ func BindRecordToUser(username, domainName, rr, recordID string) error {
 			}
 		}
 	}
-	user.Records = append(user.Records, DomainRecord{DomainName: domainName, RR: rr, RecordID: recordID})
-	return saveUsersToFile()
+	return nil
+}
+
+// countDistinctNames 统计记录列表中不同主机记录的数量（同名不同线路只计一次）。
+func countDistinctNames(records []DomainRecord) int {
+	names := make(map[string]bool)
+	for _, r := range records {
+		names[r.RR+"."+r.DomainName] = true
+	}
+	return len(names)
 }
 
-func UnbindRecordFromUser(username, domainName, rr string) (string, error) {
+// UnbindRecordFromUser 从用户名下移除记录并返回被移除记录的 RecordID 列表（可能包含空字符串）。
+// line 为空时移除该主机记录的所有解析线路。
+func UnbindRecordFromUser(username, domainName, rr, line string) ([]string, error) {
 	userMapMutex.Lock()
 	defer userMapMutex.Unlock()
 	user, ok := userMap[username]
 	if !ok {
-		return "", fmt.Errorf("找不到用户 '%s' 无法注销域名", username)
+		return nil, fmt.Errorf("找不到用户 '%s' 无法注销域名", username)
 	}
-	var recordID string
+	var recordIDs []string
 	found := false
 	var newRecords []DomainRecord
 	for _, record := range user.Records {
-		if record.DomainName == domainName && record.RR == rr {
-			recordID = record.RecordID
+		if record.DomainName == domainName && record.RR == rr && (line == "" || record.EffectiveLine() == line) {
+			recordIDs = append(recordIDs, record.RecordID)
 			found = true
 		} else {
 			newRecords = append(newRecords, record)
 		}
 	}
 	if !found {
-		return "", fmt.Errorf("用户 '%s' 名下未找到域名 %s.%s", username, rr, domainName)
+		return nil, fmt.Errorf("用户 '%s' 名下未找到域名 %s.%s", username, rr, domainName)
 	}
 	user.Records = newRecords
-	return recordID, saveUsersToFile()
+	return recordIDs, saveUsersToFile()
 }
 
-func UpdateUserKey(username, newKey string) error {
+// FindUserRecords 返回用户名下指定主机记录的所有匹配记录，line 为空时匹配所有解析线路。
+func FindUserRecords(username, domainName, rr, line string) []DomainRecord {
+	userMapMutex.RLock()
+	defer userMapMutex.RUnlock()
+	user, ok := userMap[username]
+	if !ok {
+		return nil
+	}
+	var records []DomainRecord
+	for _, record := range user.Records {
+		if record.DomainName == domainName && record.RR == rr && (line == "" || record.EffectiveLine() == line) {
+			records = append(records, record.clone())
+		}
+	}
+	return records
+}
+
+// SetRecordPaused 标记记录为暂停/恢复状态。暂停的记录仍归属于该用户并占用额度。
+func SetRecordPaused(username, domainName, rr, line string, paused bool) error {
 	userMapMutex.Lock()
 	defer userMapMutex.Unlock()
 	user, ok := userMap[username]
 	if !ok {
 		return fmt.Errorf("找不到用户 '%s'", username)
 	}
-	if len(newKey) != 32 {
-		return fmt.Errorf("新密钥长度必须为32个字符")
+	found := false
+	for i := range user.Records {
+		record := &user.Records[i]
+		if record.DomainName == domainName && record.RR == rr && (line == "" || record.EffectiveLine() == line) {
+			record.Paused = paused
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("用户 '%s' 名下未找到域名 %s.%s", username, rr, domainName)
 	}
-	user.EncryptionKey = newKey
 	return saveUsersToFile()
 }
 
+// SetRecordUpdateToken 设置（tokenHash 为空时清除）记录的专属更新令牌摘要。
+func SetRecordUpdateToken(username, domainName, rr, line, tokenHash string) error {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	for i := range user.Records {
+		record := &user.Records[i]
+		if record.DomainName == domainName && record.RR == rr && record.EffectiveLine() == line {
+			record.UpdateTokenHash = tokenHash
+			return saveUsersToFile()
+		}
+	}
+	return fmt.Errorf("用户 '%s' 名下未找到域名 %s.%s (线路: %s)", username, rr, domainName, line)
+}
+
+// FindRecordByUpdateToken 根据更新令牌摘要查找对应的用户和记录。
+func FindRecordByUpdateToken(tokenHash string) (string, DomainRecord, bool) {
+	userMapMutex.RLock()
+	defer userMapMutex.RUnlock()
+	for _, user := range userMap {
+		for _, record := range user.Records {
+			if record.UpdateTokenHash != "" && subtle.ConstantTimeCompare([]byte(record.UpdateTokenHash), []byte(tokenHash)) == 1 {
+				return user.Username, record.clone(), true
+			}
+		}
+	}
+	return "", DomainRecord{}, false
+}
+
 func saveUsersToFile() error {
-	var userConfig UserConfig
-	userList := make([]*User, 0, len(userMap))
+	var userConfig struct {
+		Users []interface{} `json:"users"`
+	}
+	userList := make([]interface{}, 0, len(userMap)+len(skippedUsers))
 	for _, user := range userMap {
+		if err := prepareUserSecrets(user); err != nil {
+			return fmt.Errorf("封装用户 '%s' 的密钥失败: %w", user.Username, err)
+		}
 		userList = append(userList, user)
 	}
+	for _, entry := range skippedUsers {
+		userList = append(userList, entry)
+	}
 	userConfig.Users = userList
 	file, err := json.MarshalIndent(userConfig, "", "  ")
 	if err != nil {
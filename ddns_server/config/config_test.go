@@ -0,0 +1,80 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+// testKey 是测试用户的 encryption_key (32 字节)。
+const testKey = "0123456789abcdef0123456789abcdef"
+
+// writeTestUsers 在临时目录中写入 users.json 并切换到该目录，返回加载结果。
+func writeTestUsers(t *testing.T, content string) error {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(UsersConfigFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadUsers()
+}
+
+// loadTestUsers 与 writeTestUsers 相同，但加载失败时直接终止测试。
+func loadTestUsers(t *testing.T, content string) {
+	t.Helper()
+	if err := writeTestUsers(t, content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 返回给调用方的用户和记录是副本，之后的修改不能反映到副本中 (go test -race 可以发现共享底层数组造成的数据竞争)。
+func TestUserCopiesAreIsolated(t *testing.T) {
+	loadTestUsers(t, `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`",
+		"records":[{"domain_name":"example.com","rr":"home","record_id":"1"}]}]}`)
+	user, _ := GetUserByKeyLookup("alice")
+	record, _ := GetUserRecord("alice", "example.com", "home", DefaultLine)
+	records := FindUserRecords("alice", "example.com", "home", "")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := SetRecordPaused("alice", "example.com", "home", "", true); err != nil {
+			t.Error(err)
+		}
+	}()
+	if user.Records[0].Paused || record.Paused || records[0].Paused {
+		t.Error("副本不应受到之后修改的影响")
+	}
+	<-done
+
+	if record, _ := GetUserRecord("alice", "example.com", "home", DefaultLine); !record.Paused {
+		t.Error("修改应保存到用户配置中")
+	}
+}
+
+func TestFindRecordByUpdateTokenReturnsCopy(t *testing.T) {
+	loadTestUsers(t, `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`",
+		"records":[{"domain_name":"example.com","rr":"home","record_id":"1","update_token_hash":"old"}]}]}`)
+	username, record, ok := FindRecordByUpdateToken("old")
+	if !ok || username != "alice" {
+		t.Fatalf("FindRecordByUpdateToken() = %q, %v", username, ok)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := SetRecordUpdateToken("alice", "example.com", "home", DefaultLine, "new"); err != nil {
+			t.Error(err)
+		}
+	}()
+	if record.UpdateTokenHash != "old" {
+		t.Error("副本不应受到之后修改的影响")
+	}
+	<-done
+
+	if _, _, ok := FindRecordByUpdateToken("old"); ok {
+		t.Error("更换令牌后旧令牌应失效")
+	}
+	if _, _, ok := FindRecordByUpdateToken("new"); !ok {
+		t.Error("应能通过新令牌找到记录")
+	}
+}
@@ -0,0 +1,72 @@
+// ===================================================================================
+// File: ddns-server/config/devices.go
+// Description: 管理用户登记的设备。每台设备持有独立的 Ed25519 密钥对，服务端只保存公钥；
+// 设备用私钥签名请求即可代替 secret_token 认证。吊销一台设备只会删除它的公钥，不影响该用户的其他设备。
+// ===================================================================================
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxDevicesPerUser 限制每个用户可登记的设备数量。
+const MaxDevicesPerUser = 20
+
+// Device 是用户登记的一台设备。PublicKey 为 base64 编码的 Ed25519 公钥。
+type Device struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+	CreatedAt string `json:"created_at"`
+}
+
+// FindDevice 返回用户名下指定名称的设备。
+func (u User) FindDevice(name string) (Device, bool) {
+	for _, device := range u.Devices {
+		if device.Name == name {
+			return device, true
+		}
+	}
+	return Device{}, false
+}
+
+// AddUserDevice 为用户登记一台新设备。设备名在用户内必须唯一。
+func AddUserDevice(username, name, publicKey string) error {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	if _, exists := user.FindDevice(name); exists {
+		return fmt.Errorf("设备 '%s' 已经登记，请先吊销或换一个名称", name)
+	}
+	if len(user.Devices) >= MaxDevicesPerUser {
+		return fmt.Errorf("设备数量已达上限 (%d)", MaxDevicesPerUser)
+	}
+	devices := make([]Device, 0, len(user.Devices)+1)
+	devices = append(devices, user.Devices...)
+	user.Devices = append(devices, Device{Name: name, PublicKey: publicKey, CreatedAt: time.Now().UTC().Format(time.RFC3339)})
+	return saveUsersToFile()
+}
+
+// RemoveUserDevice 吊销用户名下的一台设备。
+func RemoveUserDevice(username, name string) error {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	devices := make([]Device, 0, len(user.Devices))
+	for _, device := range user.Devices {
+		if device.Name != name {
+			devices = append(devices, device)
+		}
+	}
+	if len(devices) == len(user.Devices) {
+		return fmt.Errorf("用户 '%s' 名下未找到设备 '%s'", username, name)
+	}
+	user.Devices = devices
+	return saveUsersToFile()
+}
@@ -0,0 +1,60 @@
+// ===================================================================================
+// File: ddns-server/config/history.go
+// Description: 记录每条域名记录最近的更新历史（时间、写入的地址、来源地址及其国家 / ASN、所用的 API 令牌），保存在 users.json 的 history 字段中。
+// - 只有写入的地址或来源的国家 / ASN 发生变化时才追加新条目，客户端定期上报相同地址不会反复写盘。
+// - 每条记录最多保留 MaxRecordHistory 条，超出时丢弃最旧的条目。
+// ===================================================================================
+package config
+
+import (
+	"fmt"
+
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// MaxRecordHistory 是每条记录保留的历史条目数上限。
+const MaxRecordHistory = 20
+
+// RecordEvent 是一次更新的历史条目，Time 为 RFC3339 格式。
+type RecordEvent struct {
+	Time     string `json:"time"`
+	IP       string `json:"ip"`
+	SourceIP string `json:"source_ip"`
+	security.GeoInfo
+	Token string `json:"token,omitempty"`
+}
+
+// sameAs 判断两个条目的地址和来源国家 / ASN 是否相同。
+func (e RecordEvent) sameAs(other RecordEvent) bool {
+	return e.IP == other.IP && e.Country == other.Country && e.ASN == other.ASN
+}
+
+// AppendRecordEvent 将 event 追加到记录的历史中，返回追加前的最后一个条目（hasPrevious 表示是否存在）。
+func AppendRecordEvent(username, domainName, rr, line string, event RecordEvent) (previous RecordEvent, hasPrevious bool, err error) {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return RecordEvent{}, false, fmt.Errorf("找不到用户 '%s'", username)
+	}
+	for i := range user.Records {
+		record := &user.Records[i]
+		if record.DomainName != domainName || record.RR != rr || record.EffectiveLine() != line {
+			continue
+		}
+		if n := len(record.History); n > 0 {
+			previous, hasPrevious = record.History[n-1], true
+			if previous.sameAs(event) {
+				return previous, true, nil
+			}
+		}
+		// 写时复制: 历史追加到新的切片，不改动可能仍被读取方持有的旧底层数组
+		history := record.History
+		if len(history) >= MaxRecordHistory {
+			history = history[len(history)-MaxRecordHistory+1:]
+		}
+		record.History = append(append(make([]RecordEvent, 0, len(history)+1), history...), event)
+		return previous, hasPrevious, saveUsersToFile()
+	}
+	return RecordEvent{}, false, fmt.Errorf("用户 '%s' 名下未找到域名 %s.%s", username, rr, domainName)
+}
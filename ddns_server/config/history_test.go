@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAppendRecordEvent(t *testing.T) {
+	loadTestUsers(t, `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`",
+		"records":[{"domain_name":"example.com","rr":"home","record_id":"1"}]}]}`)
+	appendEvent := func(ip string) (RecordEvent, bool) {
+		t.Helper()
+		previous, hasPrevious, err := AppendRecordEvent("alice", "example.com", "home", DefaultLine, RecordEvent{IP: ip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return previous, hasPrevious
+	}
+
+	if _, hasPrevious := appendEvent("8.8.8.8"); hasPrevious {
+		t.Fatal("第一次更新不应有上一个条目")
+	}
+	if previous, _ := appendEvent("8.8.8.8"); previous.IP != "8.8.8.8" {
+		t.Fatalf("上一个条目 = %+v", previous)
+	}
+	record, _ := GetUserRecord("alice", "example.com", "home", DefaultLine)
+	if len(record.History) != 1 {
+		t.Fatalf("地址未变化时不应追加历史，当前 %d 条", len(record.History))
+	}
+
+	// 并发追加不能影响已返回的副本，超出上限时丢弃最旧的条目
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < MaxRecordHistory+5; i++ {
+			if _, _, err := AppendRecordEvent("alice", "example.com", "home", DefaultLine, RecordEvent{IP: fmt.Sprintf("8.8.4.%d", i)}); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	if len(record.History) != 1 || record.History[0].IP != "8.8.8.8" {
+		t.Error("副本不应受到之后修改的影响")
+	}
+	<-done
+
+	record, _ = GetUserRecord("alice", "example.com", "home", DefaultLine)
+	if len(record.History) != MaxRecordHistory {
+		t.Fatalf("历史条目数 = %d, want %d", len(record.History), MaxRecordHistory)
+	}
+	if last := record.History[MaxRecordHistory-1].IP; last != fmt.Sprintf("8.8.4.%d", MaxRecordHistory+4) {
+		t.Errorf("最新条目 = %s", last)
+	}
+}
@@ -0,0 +1,118 @@
+// ===================================================================================
+// File: ddns-server/config/policy.go
+// Description: 域名访问策略，判断某个用户能否在指定主域名下操作某个主机记录。
+// - managed_zones (server.ini): 服务端托管的主域名白名单，不在其中的主域名一律拒绝。
+// - allowed_zones (users.json): 用户级别的主域名白名单，为空时可使用所有托管域名。
+// - reserved_rrs (server.ini): 系统保留的主机记录（如 www、mail、@），任何用户都不能注册或删除，多级记录中任一标签为保留名称时同样拒绝。
+// - allowed_ip_classes / [dns.ip_classes] (server.ini): 全局及按主域名允许写入的地址类别 (public / private / cgnat / reserved)，默认只允许公网地址。
+// ===================================================================================
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// defaultReservedRRs 在 server.ini 未配置 reserved_rrs 时生效。
+var defaultReservedRRs = []string{
+	"@", "*", "www", "mail", "smtp", "imap", "pop", "pop3", "mx", "ns", "ns1", "ns2",
+	"ftp", "webmail", "autodiscover", "autoconfig", "_dmarc", "_domainkey",
+}
+
+// defaultIPClasses 在 server.ini 未配置 allowed_ip_classes 时生效，即只允许把记录解析到公网地址。
+var defaultIPClasses = []string{security.IPClassPublic}
+
+// normalizeNames 将逗号分隔配置中的名称统一为去除空白和末尾点号的小写形式，并丢弃空项。
+func normalizeNames(names []string) []string {
+	var result []string
+	for _, name := range names {
+		name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+		if name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func containsName(list []string, name string) bool {
+	for _, item := range list {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitHostname 将完整域名拆分为主机记录和托管主域名，优先匹配最长的托管域名。
+// 完整域名与托管域名相同时主机记录为 "@"。不属于任何托管域名时返回 false。
+func SplitHostname(hostname string) (rr, zone string, ok bool) {
+	hostname = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(hostname)), ".")
+	for _, managed := range ManagedZones {
+		if len(managed) <= len(zone) {
+			continue
+		}
+		if hostname == managed {
+			rr, zone, ok = "@", managed, true
+		} else if strings.HasSuffix(hostname, "."+managed) {
+			rr, zone, ok = strings.TrimSuffix(hostname, "."+managed), managed, true
+		}
+	}
+	return rr, zone, ok
+}
+
+// CheckZoneAccess 校验用户是否可以在 domainName 下注册、更新或删除主机记录 rr。
+func CheckZoneAccess(username, domainName, rr string) error {
+	zone := strings.ToLower(domainName)
+	if len(ManagedZones) == 0 {
+		return fmt.Errorf("服务端未配置任何托管域名，拒绝所有域名操作")
+	}
+	if !containsName(ManagedZones, zone) {
+		return fmt.Errorf("主域名 %s 不在服务端托管范围内", domainName)
+	}
+
+	userMapMutex.RLock()
+	user, ok := userMap[username]
+	var allowedZones []string
+	if ok {
+		allowedZones = user.AllowedZones
+	}
+	userMapMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	if len(allowedZones) > 0 && !containsName(allowedZones, zone) {
+		return fmt.Errorf("用户 '%s' 无权使用主域名 %s", username, domainName)
+	}
+
+	if label, reserved := reservedLabel(rr); reserved {
+		return fmt.Errorf("主机记录 '%s' 包含系统保留名称 '%s'，不允许注册、修改或删除", rr, label)
+	}
+	return nil
+}
+
+// reservedLabel 逐级检查主机记录的每个标签，任一标签为保留名称即视为保留，
+// 避免通过 mail.foo、x._domainkey 等多级记录绕过保留名单。
+func reservedLabel(rr string) (string, bool) {
+	for _, label := range strings.Split(strings.ToLower(rr), ".") {
+		if containsName(ReservedRRs, label) {
+			return label, true
+		}
+	}
+	return "", false
+}
+
+// CheckAddressClass 校验地址 ip 的类别是否允许写入主域名 domainName 下的记录。
+// 主域名在 [dns.ip_classes] 中单独配置时使用其配置，否则使用全局的 allowed_ip_classes。
+func CheckAddressClass(domainName, ip string) error {
+	allowed, ok := ZoneIPClasses[strings.ToLower(domainName)]
+	if !ok {
+		allowed = AllowedIPClasses
+	}
+	class := security.ClassifyIPv4(ip)
+	if !containsName(allowed, class) {
+		return fmt.Errorf("地址 %s 属于 %s 类别，主域名 %s 只允许 %s 类别的地址", ip, class, domainName, strings.Join(allowed, ", "))
+	}
+	return nil
+}
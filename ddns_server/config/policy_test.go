@@ -0,0 +1,52 @@
+package config
+
+import "testing"
+
+// setTestZones 设置托管域名和保留名单，测试结束后恢复。
+func setTestZones(t *testing.T, zones, reserved []string) {
+	t.Helper()
+	oldZones, oldReserved := ManagedZones, ReservedRRs
+	ManagedZones, ReservedRRs = zones, reserved
+	t.Cleanup(func() { ManagedZones, ReservedRRs = oldZones, oldReserved })
+}
+
+func TestCheckZoneAccess(t *testing.T) {
+	loadTestUsers(t, `{"users":[
+		{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`"},
+		{"username":"bob","secret_token":"tok","encryption_key":"`+testKey+`","allowed_zones":["example.org"]}]}`)
+	setTestZones(t, []string{"example.com", "example.org"}, defaultReservedRRs)
+
+	tests := []struct {
+		username, zone, rr string
+		ok                 bool
+	}{
+		{"alice", "example.com", "home", true},
+		{"alice", "example.com", "home.lab", true},
+		{"alice", "Example.COM", "home", true},
+		{"alice", "other.com", "home", false},
+		{"alice", "example.com", "www", false},
+		{"alice", "example.com", "WWW", false},
+		{"alice", "example.com", "@", false},
+		{"alice", "example.com", "mail.foo", false},
+		{"alice", "example.com", "x._domainkey", false},
+		{"alice", "example.com", "*.home", false},
+		{"alice", "example.com", "mailbox", true},
+		{"bob", "example.com", "home", false},
+		{"bob", "example.org", "home", true},
+		{"carol", "example.com", "home", false},
+	}
+	for _, tt := range tests {
+		err := CheckZoneAccess(tt.username, tt.zone, tt.rr)
+		if (err == nil) != tt.ok {
+			t.Errorf("CheckZoneAccess(%q, %q, %q) = %v, want ok=%v", tt.username, tt.zone, tt.rr, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckZoneAccessWithoutManagedZones(t *testing.T) {
+	loadTestUsers(t, `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`"}]}`)
+	setTestZones(t, nil, defaultReservedRRs)
+	if err := CheckZoneAccess("alice", "example.com", "home"); err == nil {
+		t.Fatal("未配置托管域名时应拒绝所有域名操作")
+	}
+}
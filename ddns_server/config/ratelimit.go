@@ -0,0 +1,107 @@
+// ===================================================================================
+// File: ddns-server/config/ratelimit.go
+// Description: 从 server.ini 加载速率限制策略，由 main.go 传给 security.SetRateLimits。
+// - [ratelimit]: 每个来源IP的默认速率和突发量，每个用户的默认速率和突发量，以及令牌桶的闲置清理时间和数量上限。
+// - [ratelimit.routes]: 按路由覆盖来源IP的限速，键为请求路径（以 "/" 结尾时按前缀匹配），值为 "每分钟次数, 突发量"。
+// - [ratelimit.users]: 按用户覆盖限速，键为用户名，值的格式同上。每分钟次数为 0 表示不限速。
+// ===================================================================================
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keepsea/goddns/ddns_server/security"
+	"gopkg.in/ini.v1"
+)
+
+var (
+	RateLimitDefault    = security.RateRule{PerMinute: 12, Burst: 5}
+	RateLimitRoutes     map[string]security.RateRule
+	RateLimitUser       = security.RateRule{PerMinute: 30, Burst: 10}
+	RateLimitUsers      map[string]security.RateRule
+	RateLimitIdle       = 10 * time.Minute
+	RateLimitMaxEntries = 100000
+)
+
+func loadRateLimits(cfg *ini.File) error {
+	section := cfg.Section("ratelimit")
+	RateLimitDefault = security.RateRule{
+		PerMinute: section.Key("rate_per_minute").MustFloat64(12),
+		Burst:     section.Key("burst").MustInt(5),
+	}
+	RateLimitUser = security.RateRule{
+		PerMinute: section.Key("user_rate_per_minute").MustFloat64(30),
+		Burst:     section.Key("user_burst").MustInt(10),
+	}
+	if err := validateRateRule(RateLimitDefault); err != nil {
+		return fmt.Errorf("[ratelimit] 段的 rate_per_minute/burst 无效: %w", err)
+	}
+	if err := validateRateRule(RateLimitUser); err != nil {
+		return fmt.Errorf("[ratelimit] 段的 user_rate_per_minute/user_burst 无效: %w", err)
+	}
+	RateLimitIdle = time.Duration(section.Key("idle_seconds").MustInt(600)) * time.Second
+	RateLimitMaxEntries = section.Key("max_entries").MustInt(100000)
+	if RateLimitIdle <= 0 || RateLimitMaxEntries <= 0 {
+		return fmt.Errorf("[ratelimit] 段的 idle_seconds 和 max_entries 必须大于 0")
+	}
+
+	RateLimitRoutes = make(map[string]security.RateRule)
+	for _, key := range cfg.Section("ratelimit.routes").Keys() {
+		if !strings.HasPrefix(key.Name(), "/") {
+			return fmt.Errorf("[ratelimit.routes] 段的路由 '%s' 必须以 / 开头", key.Name())
+		}
+		rule, err := parseRateRule(key.String())
+		if err != nil {
+			return fmt.Errorf("[ratelimit.routes] 段的路由 '%s' 配置无效: %w", key.Name(), err)
+		}
+		RateLimitRoutes[key.Name()] = rule
+	}
+
+	RateLimitUsers = make(map[string]security.RateRule)
+	for _, key := range cfg.Section("ratelimit.users").Keys() {
+		if err := security.ValidateUsername(key.Name()); err != nil {
+			return fmt.Errorf("[ratelimit.users] 段的用户名 '%s' 无效: %w", key.Name(), err)
+		}
+		rule, err := parseRateRule(key.String())
+		if err != nil {
+			return fmt.Errorf("[ratelimit.users] 段的用户 '%s' 配置无效: %w", key.Name(), err)
+		}
+		RateLimitUsers[key.Name()] = rule
+	}
+	return nil
+}
+
+// parseRateRule 解析 "每分钟次数, 突发量" 形式的限速配置。只填写每分钟次数时突发量与其相同（至少为 1）。
+func parseRateRule(value string) (security.RateRule, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) > 2 {
+		return security.RateRule{}, fmt.Errorf("格式应为 \"每分钟次数, 突发量\"")
+	}
+	perMinute, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return security.RateRule{}, fmt.Errorf("每分钟次数 '%s' 不是有效的数字", strings.TrimSpace(parts[0]))
+	}
+	burst := int(perMinute)
+	if len(parts) == 2 {
+		if burst, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			return security.RateRule{}, fmt.Errorf("突发量 '%s' 不是有效的整数", strings.TrimSpace(parts[1]))
+		}
+	} else if burst < 1 {
+		burst = 1
+	}
+	rule := security.RateRule{PerMinute: perMinute, Burst: burst}
+	return rule, validateRateRule(rule)
+}
+
+func validateRateRule(rule security.RateRule) error {
+	if rule.PerMinute < 0 {
+		return fmt.Errorf("每分钟次数不能为负数")
+	}
+	if rule.PerMinute > 0 && rule.Burst < 1 {
+		return fmt.Errorf("突发量至少为 1")
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// ===================================================================================
+// File: ddns-server/config/rotation.go
+// Description: 实现加密密钥和 secret_token 的两阶段轮换，避免客户端在保存新凭据失败时被锁在门外。两者语义相同：
+// - Begin*Rotation: 登记待生效的新凭据。在宽限期 (rotation_grace_seconds) 内，新旧凭据都可用于认证。
+// - Commit*Rotation: 新凭据正式生效，旧凭据作废。服务端在收到第一个使用新凭据的请求时自动提交。
+// - Abort*Rotation: 放弃新凭据，继续使用旧凭据。
+// - 宽限期结束仍未提交或放弃时，旧凭据自动过期，新凭据生效 (ExpireRotations)。
+// ===================================================================================
+package config
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// KeyRotationExpiry 返回进行中的密钥轮换的到期时间。没有进行中的轮换时 ok 为 false。
+func (u User) KeyRotationExpiry() (time.Time, bool) {
+	if u.PendingEncryptionKey == "" {
+		return time.Time{}, false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, u.PendingKeyExpiresAt)
+	if err != nil {
+		// 到期时间损坏时按已到期处理，让新密钥尽快生效。
+		return time.Time{}, true
+	}
+	return expiresAt, true
+}
+
+// BeginKeyRotation 为用户登记新密钥，返回旧密钥的过期时间。已有进行中的轮换时会被新的轮换替换。
+func BeginKeyRotation(username, newKey string) (time.Time, error) {
+	if len(newKey) != 32 {
+		return time.Time{}, fmt.Errorf("新密钥长度必须为32个字符")
+	}
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return time.Time{}, fmt.Errorf("找不到用户 '%s'", username)
+	}
+	if newKey == user.EncryptionKey {
+		return time.Time{}, fmt.Errorf("新密钥不能与当前密钥相同")
+	}
+	expiresAt := time.Now().Add(RotationGrace).UTC().Truncate(time.Second)
+	user.PendingEncryptionKey = newKey
+	user.PendingKeyExpiresAt = expiresAt.Format(time.RFC3339)
+	return expiresAt, saveUsersToFile()
+}
+
+// CommitKeyRotation 使进行中的轮换立即生效。
+func CommitKeyRotation(username string) error {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	if user.PendingEncryptionKey == "" {
+		return fmt.Errorf("当前没有进行中的密钥轮换")
+	}
+	commitPendingKey(user)
+	return saveUsersToFile()
+}
+
+// AbortKeyRotation 放弃进行中的轮换，继续使用旧密钥。
+func AbortKeyRotation(username string) error {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	if user.PendingEncryptionKey == "" {
+		return fmt.Errorf("当前没有进行中的密钥轮换")
+	}
+	user.PendingEncryptionKey = ""
+	user.PendingKeyExpiresAt = ""
+	return saveUsersToFile()
+}
+
+// TokenRotationExpiry 返回进行中的 secret_token 轮换的到期时间。没有进行中的轮换时 ok 为 false。
+func (u User) TokenRotationExpiry() (time.Time, bool) {
+	if u.PendingSecretTokenHash == "" {
+		return time.Time{}, false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, u.PendingTokenExpiresAt)
+	if err != nil {
+		return time.Time{}, true
+	}
+	return expiresAt, true
+}
+
+// RotationDue 判断用户是否有已过宽限期、需要完成的轮换。
+func (u User) RotationDue(now time.Time) bool {
+	if expiresAt, ok := u.KeyRotationExpiry(); ok && !now.Before(expiresAt) {
+		return true
+	}
+	if expiresAt, ok := u.TokenRotationExpiry(); ok && !now.Before(expiresAt) {
+		return true
+	}
+	return false
+}
+
+// BeginTokenRotation 为用户登记新 secret_token 的哈希，返回旧令牌的过期时间。
+func BeginTokenRotation(username, newTokenHash string) (time.Time, error) {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return time.Time{}, fmt.Errorf("找不到用户 '%s'", username)
+	}
+	expiresAt := time.Now().Add(RotationGrace).UTC().Truncate(time.Second)
+	user.PendingSecretTokenHash = newTokenHash
+	user.PendingTokenExpiresAt = expiresAt.Format(time.RFC3339)
+	return expiresAt, saveUsersToFile()
+}
+
+// CommitTokenRotation 使进行中的 secret_token 轮换立即生效。
+func CommitTokenRotation(username string) error {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	if user.PendingSecretTokenHash == "" {
+		return fmt.Errorf("当前没有进行中的令牌轮换")
+	}
+	commitPendingToken(user)
+	return saveUsersToFile()
+}
+
+// AbortTokenRotation 放弃进行中的 secret_token 轮换，继续使用旧令牌。
+func AbortTokenRotation(username string) error {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	if user.PendingSecretTokenHash == "" {
+		return fmt.Errorf("当前没有进行中的令牌轮换")
+	}
+	user.PendingSecretTokenHash = ""
+	user.PendingTokenExpiresAt = ""
+	return saveUsersToFile()
+}
+
+// ExpireRotations 完成用户所有已过宽限期的轮换（旧凭据过期，新凭据生效），有变化时返回 true。
+func ExpireRotations(username string) (bool, error) {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return false, fmt.Errorf("找不到用户 '%s'", username)
+	}
+	if !finishExpiredRotations(user, time.Now()) {
+		return false, nil
+	}
+	return true, saveUsersToFile()
+}
+
+// finishExpiredRotations 在宽限期结束后让新凭据生效。调用方需持有写锁并负责保存。
+func finishExpiredRotations(user *User, now time.Time) bool {
+	changed := false
+	if expiresAt, ok := user.KeyRotationExpiry(); ok && !now.Before(expiresAt) {
+		log.Printf("用户 '%s' 的密钥轮换宽限期已结束，旧密钥已过期，新密钥生效。", user.Username)
+		commitPendingKey(user)
+		changed = true
+	}
+	if expiresAt, ok := user.TokenRotationExpiry(); ok && !now.Before(expiresAt) {
+		log.Printf("用户 '%s' 的令牌轮换宽限期已结束，旧令牌已过期，新令牌生效。", user.Username)
+		commitPendingToken(user)
+		changed = true
+	}
+	return changed
+}
+
+func commitPendingKey(user *User) {
+	user.EncryptionKey = user.PendingEncryptionKey
+	user.PendingEncryptionKey = ""
+	user.PendingKeyExpiresAt = ""
+}
+
+func commitPendingToken(user *User) {
+	user.SecretTokenHash = user.PendingSecretTokenHash
+	user.PendingSecretTokenHash = ""
+	user.PendingTokenExpiresAt = ""
+}
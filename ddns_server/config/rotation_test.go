@@ -0,0 +1,159 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+const testNewKey = "fedcba9876543210fedcba9876543210"
+
+func TestKeyRotationCommitAndAbort(t *testing.T) {
+	loadTestUsers(t, `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`"}]}`)
+
+	if _, err := BeginKeyRotation("alice", testKey); err == nil {
+		t.Fatal("新密钥与当前密钥相同时应拒绝")
+	}
+	if _, err := BeginKeyRotation("alice", "short"); err == nil {
+		t.Fatal("长度不为 32 的新密钥应拒绝")
+	}
+	expiresAt, err := BeginKeyRotation("alice", testNewKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expiresAt); d < RotationGrace-time.Minute || d > RotationGrace {
+		t.Fatalf("到期时间应约为宽限期之后，得到 %v", d)
+	}
+	user, _ := GetUserByKeyLookup("alice")
+	if user.EncryptionKey != testKey || user.PendingEncryptionKey != testNewKey {
+		t.Fatal("宽限期内旧密钥仍应生效，新密钥处于待定状态")
+	}
+
+	if err := AbortKeyRotation("alice"); err != nil {
+		t.Fatal(err)
+	}
+	user, _ = GetUserByKeyLookup("alice")
+	if user.EncryptionKey != testKey || user.PendingEncryptionKey != "" || user.PendingKeyExpiresAt != "" {
+		t.Fatal("放弃轮换后应继续使用旧密钥")
+	}
+	if err := AbortKeyRotation("alice"); err == nil {
+		t.Fatal("没有进行中的轮换时放弃应返回错误")
+	}
+
+	if _, err := BeginKeyRotation("alice", testNewKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := CommitKeyRotation("alice"); err != nil {
+		t.Fatal(err)
+	}
+	user, _ = GetUserByKeyLookup("alice")
+	if user.EncryptionKey != testNewKey || user.PendingEncryptionKey != "" {
+		t.Fatal("提交后新密钥应生效")
+	}
+	if err := CommitKeyRotation("alice"); err == nil {
+		t.Fatal("没有进行中的轮换时提交应返回错误")
+	}
+
+	// 提交结果已写入 users.json
+	if err := LoadUsers(); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := GetUserByKeyLookup("alice"); user.EncryptionKey != testNewKey {
+		t.Fatal("重新加载后应使用新密钥")
+	}
+}
+
+func TestKeyRotationExpiry(t *testing.T) {
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name      string
+		expiresAt string
+		wantKey   string
+	}{
+		{"宽限期内保持待定", future, testKey},
+		{"宽限期结束后新密钥生效", past, testNewKey},
+		{"到期时间损坏时按已到期处理", "not-a-time", testNewKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 加载时会完成已到期的轮换
+			loadTestUsers(t, `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`",
+				"pending_encryption_key":"`+testNewKey+`","pending_key_expires_at":"`+tt.expiresAt+`"}]}`)
+			if user, _ := GetUserByKeyLookup("alice"); user.EncryptionKey != tt.wantKey {
+				t.Fatalf("加载后 encryption_key = %q, want %q", user.EncryptionKey, tt.wantKey)
+			}
+		})
+	}
+
+	// 运行期间到期的轮换由 ExpireRotations 完成
+	loadTestUsers(t, `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`"}]}`)
+	if _, err := BeginKeyRotation("alice", testNewKey); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := ExpireRotations("alice"); changed || err != nil {
+		t.Fatalf("宽限期内 ExpireRotations() = %v, %v", changed, err)
+	}
+	userMapMutex.Lock()
+	userMap["alice"].PendingKeyExpiresAt = past
+	userMapMutex.Unlock()
+	if user, _ := GetUserByKeyLookup("alice"); !user.RotationDue(time.Now()) {
+		t.Fatal("RotationDue 应报告已到期的轮换")
+	}
+	if changed, err := ExpireRotations("alice"); !changed || err != nil {
+		t.Fatalf("到期后 ExpireRotations() = %v, %v", changed, err)
+	}
+	if user, _ := GetUserByKeyLookup("alice"); user.EncryptionKey != testNewKey || user.PendingEncryptionKey != "" {
+		t.Fatal("到期后新密钥应生效")
+	}
+}
+
+func TestTokenRotation(t *testing.T) {
+	loadTestUsers(t, `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`"}]}`)
+	newHash, err := security.HashSecret("tok-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := BeginTokenRotation("alice", newHash); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := GetUserByKeyLookup("alice")
+	if !security.VerifySecret(user.SecretTokenHash, "tok") || user.PendingSecretTokenHash != newHash {
+		t.Fatal("宽限期内旧令牌仍应有效，新令牌处于待定状态")
+	}
+	if err := AbortTokenRotation("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := GetUserByKeyLookup("alice"); user.PendingSecretTokenHash != "" || !security.VerifySecret(user.SecretTokenHash, "tok") {
+		t.Fatal("放弃轮换后应继续使用旧令牌")
+	}
+	if err := CommitTokenRotation("alice"); err == nil {
+		t.Fatal("没有进行中的轮换时提交应返回错误")
+	}
+
+	if _, err := BeginTokenRotation("alice", newHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := CommitTokenRotation("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := GetUserByKeyLookup("alice"); user.SecretTokenHash != newHash || user.PendingSecretTokenHash != "" {
+		t.Fatal("提交后新令牌应生效")
+	}
+
+	// 宽限期结束后旧令牌过期
+	if _, err := BeginTokenRotation("alice", "pbkdf2-sha256$1$AA$AA"); err != nil {
+		t.Fatal(err)
+	}
+	userMapMutex.Lock()
+	userMap["alice"].PendingTokenExpiresAt = time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+	userMapMutex.Unlock()
+	if changed, err := ExpireRotations("alice"); !changed || err != nil {
+		t.Fatalf("ExpireRotations() = %v, %v", changed, err)
+	}
+	if user, _ := GetUserByKeyLookup("alice"); user.SecretTokenHash != "pbkdf2-sha256$1$AA$AA" {
+		t.Fatal("到期后新令牌应生效")
+	}
+}
@@ -0,0 +1,125 @@
+// ===================================================================================
+// File: ddns-server/config/secrets.go
+// Description: 负责 users.json 中用户凭据的静态保护。
+// - secret_token 只以加盐哈希 (secret_token_hash) 的形式保存；管理员新增用户时可直接填写明文 secret_token，服务启动时会自动迁移为哈希。
+// - encryption_key（以及密钥轮换期间的 pending_encryption_key）和 TOTP 密钥在配置主密钥后以封装形式保存；明文字段会在启动时一次性迁移。
+// - 主密钥优先从环境变量 GODDNS_MASTER_KEY 读取，其次读取 server.ini 中 master_key_file 指定的文件。
+// ===================================================================================
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// MasterKeyEnv 是存放主密钥的环境变量名。
+const MasterKeyEnv = "GODDNS_MASTER_KEY"
+
+// LoadMasterKey 读取并解析主密钥。未配置主密钥时返回 nil, nil。
+func LoadMasterKey() ([]byte, error) {
+	if encoded := os.Getenv(MasterKeyEnv); encoded != "" {
+		return security.ParseMasterKey(encoded)
+	}
+	if MasterKeyFile == "" {
+		log.Printf("警告: 未配置主密钥 (环境变量 %s 或 master_key_file)，用户的 encryption_key 将以明文保存在 %s 中。", MasterKeyEnv, UsersConfigFile)
+		return nil, nil
+	}
+	data, err := os.ReadFile(MasterKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取主密钥文件 %s: %w", MasterKeyFile, err)
+	}
+	return security.ParseMasterKey(string(data))
+}
+
+// loadUserSecrets 从刚解析出的用户配置中还原运行时凭据，并迁移明文字段。返回值表示是否发生了需要写回的迁移。
+func loadUserSecrets(user *User) (bool, error) {
+	changed := false
+	if user.SecretToken != "" {
+		hash, err := security.HashSecret(user.SecretToken)
+		if err != nil {
+			return false, err
+		}
+		user.SecretTokenHash = hash
+		user.SecretToken = ""
+		changed = true
+	}
+
+	key, sealed, err := restoreKey(user.PlainEncryptionKey, user.SealedEncryptionKey)
+	if err != nil {
+		return false, err
+	}
+	user.EncryptionKey = key
+	if sealed {
+		user.sealedKeySource = key
+	} else if key != "" && security.MasterKeyConfigured() {
+		changed = true
+	}
+
+	pendingKey, pendingSealed, err := restoreKey(user.PendingPlainEncryptionKey, user.PendingSealedEncryptionKey)
+	if err != nil {
+		return false, err
+	}
+	user.PendingEncryptionKey = pendingKey
+	if pendingSealed {
+		user.pendingSealedKeySource = pendingKey
+	} else if pendingKey != "" && security.MasterKeyConfigured() {
+		changed = true
+	}
+
+	totpSecret, totpSealed, err := restoreKey(user.TOTPPlainSecret, user.TOTPSealedSecret)
+	if err != nil {
+		return false, err
+	}
+	user.TOTPSecret = totpSecret
+	if totpSealed {
+		user.totpSealedSource = totpSecret
+	} else if totpSecret != "" && security.MasterKeyConfigured() {
+		changed = true
+	}
+	return changed, nil
+}
+
+// restoreKey 从明文或封装形式中还原密钥。sealed 表示密钥来自封装字段。
+func restoreKey(plain, sealedValue string) (key string, sealed bool, err error) {
+	if sealedValue != "" {
+		key, err := security.Unseal(sealedValue)
+		return key, err == nil, err
+	}
+	return plain, false, nil
+}
+
+// prepareUserSecrets 在写回文件前，根据运行时密钥更新需要落盘的密钥字段。
+func prepareUserSecrets(user *User) error {
+	if err := persistKey(user.EncryptionKey, &user.PlainEncryptionKey, &user.SealedEncryptionKey, &user.sealedKeySource); err != nil {
+		return err
+	}
+	if err := persistKey(user.PendingEncryptionKey, &user.PendingPlainEncryptionKey, &user.PendingSealedEncryptionKey, &user.pendingSealedKeySource); err != nil {
+		return err
+	}
+	return persistKey(user.TOTPSecret, &user.TOTPPlainSecret, &user.TOTPSealedSecret, &user.totpSealedSource)
+}
+
+// persistKey 将运行时密钥 key 写入对应的落盘字段：配置了主密钥时写入封装字段，否则写入明文字段。
+// source 记录封装字段当前对应的明文，密钥未变化时不重新封装。
+func persistKey(key string, plain, sealed, source *string) error {
+	if key == "" {
+		*plain, *sealed, *source = "", "", ""
+		return nil
+	}
+	if !security.MasterKeyConfigured() {
+		*plain, *sealed = key, ""
+		return nil
+	}
+	if *sealed == "" || *source != key {
+		value, err := security.Seal(key)
+		if err != nil {
+			return err
+		}
+		*sealed, *source = value, key
+	}
+	*plain = ""
+	return nil
+}
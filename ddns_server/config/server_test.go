@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// loadTestServerConfig 在临时目录中写入 server.ini 并加载，测试结束后恢复被校验拒绝的时长配置，
+// 避免其他测试（如密钥轮换）读到 0 值。
+func loadTestServerConfig(t *testing.T, content string) error {
+	t.Helper()
+	oldSkew, oldGrace := MaxClockSkew, RotationGrace
+	t.Cleanup(func() { MaxClockSkew, RotationGrace = oldSkew, oldGrace })
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(ServerConfigFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadServerConfig()
+}
+
+func TestLoadServerConfigRejectsNonPositiveDurations(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"默认值", "[server]\nlisten_port = 9876\n", ""},
+		{"时钟偏差为 0", "[security]\nmax_clock_skew_seconds = 0\n", "max_clock_skew_seconds"},
+		{"时钟偏差为负数", "[security]\nmax_clock_skew_seconds = -1\n", "max_clock_skew_seconds"},
+		{"轮换宽限期为 0", "[security]\nrotation_grace_seconds = 0\n", "rotation_grace_seconds"},
+		{"轮换宽限期为负数", "[security]\nrotation_grace_seconds = -60\n", "rotation_grace_seconds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadTestServerConfig(t, tt.content)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadServerConfig() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadServerConfig() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
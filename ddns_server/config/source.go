@@ -0,0 +1,129 @@
+// ===================================================================================
+// File: ddns-server/config/source.go
+// Description: 更新请求的来源网络限制，由管理员在 users.json 中为用户或单个 API 令牌配置，两者同时配置时都必须满足。
+// - source_cidrs: 只接受来自这些网段的更新请求（按 ClientIP 判断）。
+// - allowed_ip_ranges: 记录只能被更新为这些网段内的地址。
+// - require_source_match: 记录只能被更新为请求的来源地址，即不接受客户端指定其他的 new_ip / myip。
+// - allowed_countries / allowed_asns: 只接受来自这些国家 (ISO 3166 代码) / 自治系统的更新请求，需要在 server.ini 的 [geoip] 段配置对应的数据库。
+// 即使令牌泄露，持有者也无法在其他网络中把用户的域名指向自己的服务器。
+// ===================================================================================
+package config
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// SourcePolicy 是用户或 API 令牌的来源网络限制，字段为空表示不限制。
+type SourcePolicy struct {
+	SourceCIDRs        []string `json:"source_cidrs,omitempty"`
+	AllowedIPRanges    []string `json:"allowed_ip_ranges,omitempty"`
+	RequireSourceMatch bool     `json:"require_source_match,omitempty"`
+	AllowedCountries   []string `json:"allowed_countries,omitempty"`
+	AllowedASNs        []uint   `json:"allowed_asns,omitempty"`
+}
+
+// validate 检查配置中的网段格式，在加载 users.json 时调用。
+func (p SourcePolicy) validate() error {
+	if _, err := security.ParseCIDRs(p.SourceCIDRs); err != nil {
+		return fmt.Errorf("source_cidrs 配置无效: %w", err)
+	}
+	if _, err := security.ParseCIDRs(p.AllowedIPRanges); err != nil {
+		return fmt.Errorf("allowed_ip_ranges 配置无效: %w", err)
+	}
+	countryDB, asnDB := security.GeoIPAvailable()
+	if len(p.AllowedCountries) > 0 && !countryDB {
+		log.Printf("警告: 配置了 allowed_countries 但未加载国家数据库 ([geoip] country_db)，相关更新将全部被拒绝。")
+	}
+	if len(p.AllowedASNs) > 0 && !asnDB {
+		log.Printf("警告: 配置了 allowed_asns 但未加载 ASN 数据库 ([geoip] asn_db)，相关更新将全部被拒绝。")
+	}
+	return nil
+}
+
+// validateSourcePolicies 检查用户及其所有 API 令牌的来源网络限制。
+func (u *User) validateSourcePolicies() error {
+	if err := u.SourcePolicy.validate(); err != nil {
+		return err
+	}
+	for _, token := range u.APITokens {
+		if err := token.SourcePolicy.validate(); err != nil {
+			return fmt.Errorf("API 令牌 '%s' 的 %w", token.Name, err)
+		}
+	}
+	return nil
+}
+
+// CheckSource 判断来自 sourceIP 的请求能否将记录更新为 newIP。geo 为 sourceIP 的国家 / ASN 信息，查不到时按不匹配处理。
+func (p SourcePolicy) CheckSource(sourceIP, newIP string, geo security.GeoInfo) error {
+	source := net.ParseIP(sourceIP)
+	if len(p.SourceCIDRs) > 0 {
+		nets, err := security.ParseCIDRs(p.SourceCIDRs)
+		if err != nil || source == nil || !security.ContainsIP(nets, source) {
+			return fmt.Errorf("不允许从 %s 发起更新，允许的来源网段: %s", sourceIP, strings.Join(p.SourceCIDRs, ", "))
+		}
+	}
+	if len(p.AllowedIPRanges) > 0 {
+		nets, err := security.ParseCIDRs(p.AllowedIPRanges)
+		if ip := net.ParseIP(newIP); err != nil || ip == nil || !security.ContainsIP(nets, ip) {
+			return fmt.Errorf("地址 %s 不在允许的范围内: %s", newIP, strings.Join(p.AllowedIPRanges, ", "))
+		}
+	}
+	if p.RequireSourceMatch && (source == nil || !source.Equal(net.ParseIP(newIP))) {
+		return fmt.Errorf("只能将记录更新为请求的来源地址 %s，不接受指定的地址 %s", sourceIP, newIP)
+	}
+	if len(p.AllowedCountries) > 0 && !containsCountry(p.AllowedCountries, geo.Country) {
+		return fmt.Errorf("不允许从国家/地区 '%s' (%s) 发起更新，允许的国家/地区: %s", geo.Country, sourceIP, strings.Join(p.AllowedCountries, ", "))
+	}
+	if len(p.AllowedASNs) > 0 && !containsASN(p.AllowedASNs, geo.ASN) {
+		return fmt.Errorf("不允许从 AS%d (%s) 发起更新，允许的自治系统: %s", geo.ASN, sourceIP, formatASNs(p.AllowedASNs))
+	}
+	return nil
+}
+
+func containsCountry(list []string, country string) bool {
+	for _, item := range list {
+		if country != "" && strings.EqualFold(item, country) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsASN(list []uint, asn uint) bool {
+	for _, item := range list {
+		if asn != 0 && item == asn {
+			return true
+		}
+	}
+	return false
+}
+
+func formatASNs(asns []uint) string {
+	names := make([]string, len(asns))
+	for i, asn := range asns {
+		names[i] = fmt.Sprintf("AS%d", asn)
+	}
+	return strings.Join(names, ", ")
+}
+
+// CheckUpdateSource 依次检查用户和 API 令牌（若有）的来源网络限制。
+func CheckUpdateSource(username string, apiToken *APIToken, sourceIP, newIP string, geo security.GeoInfo) error {
+	user, ok := GetUserByKeyLookup(username)
+	if !ok {
+		return fmt.Errorf("用户 '%s' 不存在", username)
+	}
+	if err := user.SourcePolicy.CheckSource(sourceIP, newIP, geo); err != nil {
+		return err
+	}
+	if apiToken != nil {
+		if err := apiToken.SourcePolicy.CheckSource(sourceIP, newIP, geo); err != nil {
+			return fmt.Errorf("令牌 '%s' 的限制: %w", apiToken.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+func TestLoadUsersRejectsInvalidSourcePolicy(t *testing.T) {
+	tests := []struct {
+		name  string
+		users string
+		want  string
+	}{
+		{"用户的网段无效", `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"` + testKey + `","source_cidrs":["not-a-cidr"]}]}`, "source_cidrs"},
+		{"令牌的网段无效", `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"` + testKey + `","api_tokens":[{"id":"t1","name":"router","scope":"update","allowed_ip_ranges":["10.0.0.0/33"]}]}]}`, "router"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := writeTestUsers(t, tt.users)
+			if err == nil || !strings.Contains(err.Error(), "alice") || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("LoadUsers() = %v，应拒绝启动并指出出错的用户和字段", err)
+			}
+			// 启动失败不能改写 users.json
+			data, _ := os.ReadFile(UsersConfigFile)
+			if string(data) != tt.users {
+				t.Fatalf("users.json 被改写: %s", data)
+			}
+		})
+	}
+}
+
+func TestLoadUsersKeepsSkippedEntries(t *testing.T) {
+	// alice 的明文令牌会在加载时迁移并立即写回，bob 缺少 encryption_key 会被跳过，但不能因此被删除
+	loadTestUsers(t, `{"users":[
+		{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`","domain_limit":1,"records":[]},
+		{"username":"bob","secret_token":"tok-bob","domain_limit":3,"records":[{"domain_name":"example.com","rr":"nas","record_id":"42"}]}
+	]}`)
+	if _, ok := GetUserByKeyLookup("bob"); ok {
+		t.Fatal("配置不完整的用户不应被加载")
+	}
+	data, err := os.ReadFile(UsersConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"secret_token": "tok-bob"`, `"record_id": "42"`, `"secret_token_hash"`} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("写回的 users.json 缺少 %s:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), `"secret_token": "tok"`) {
+		t.Fatalf("alice 的明文令牌应已迁移:\n%s", data)
+	}
+}
+
+func TestCheckUpdateSource(t *testing.T) {
+	loadTestUsers(t, `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`",
+		"source_cidrs":["198.51.100.0/24"],"allowed_countries":["CN"],
+		"api_tokens":[{"id":"t1","name":"router","scope":"update","require_source_match":true}]}]}`)
+	user, _ := GetUserByKeyLookup("alice")
+	token := &user.APITokens[0]
+	cn := security.GeoInfo{Country: "CN"}
+
+	tests := []struct {
+		name     string
+		token    *APIToken
+		sourceIP string
+		newIP    string
+		geo      security.GeoInfo
+		wantErr  string
+	}{
+		{"满足所有限制", nil, "198.51.100.7", "203.0.113.5", cn, ""},
+		{"来源网段之外", nil, "192.0.2.1", "203.0.113.5", cn, "不允许从 192.0.2.1 发起更新"},
+		{"来源国家不符", nil, "198.51.100.7", "203.0.113.5", security.GeoInfo{Country: "US"}, "国家/地区 'US'"},
+		{"查不到国家", nil, "198.51.100.7", "203.0.113.5", security.GeoInfo{}, "国家/地区 ''"},
+		{"令牌要求来源与地址一致", token, "198.51.100.7", "203.0.113.5", cn, "令牌 'router' 的限制"},
+		{"令牌与用户的限制都满足", token, "198.51.100.7", "198.51.100.7", cn, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckUpdateSource("alice", tt.token, tt.sourceIP, tt.newIP, tt.geo)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckUpdateSource() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CheckUpdateSource() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
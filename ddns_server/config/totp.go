@@ -0,0 +1,97 @@
+// ===================================================================================
+// File: ddns-server/config/totp.go
+// Description: 管理用户的 TOTP 二次验证状态。
+// - 登记分两步：BeginTOTPEnrollment 生成待确认的密钥（只保存在内存中），ConfirmTOTPEnrollment 用一个有效验证码确认后才正式启用。
+// - ConsumeTOTP 校验验证码并记录已使用的时间步，同一验证码不能被重复使用。
+// - TOTP 密钥与加密密钥一样，在配置主密钥后以封装形式保存。
+// ===================================================================================
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// ErrInvalidTOTP 表示验证码错误、已过期或已被使用过。
+var ErrInvalidTOTP = errors.New("TOTP 验证码无效或已被使用")
+
+// TOTPEnabled 判断用户是否已启用 TOTP 二次验证。
+func (u User) TOTPEnabled() bool {
+	return u.TOTPSecret != ""
+}
+
+// BeginTOTPEnrollment 为用户生成新的待确认 TOTP 密钥。已启用 TOTP 的用户需要先停用。
+func BeginTOTPEnrollment(username string) (string, error) {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return "", fmt.Errorf("找不到用户 '%s'", username)
+	}
+	if user.TOTPEnabled() {
+		return "", fmt.Errorf("已启用 TOTP，如需更换请先停用")
+	}
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	user.pendingTOTPSecret = secret
+	return secret, nil
+}
+
+// ConfirmTOTPEnrollment 用验证码确认待登记的密钥并正式启用 TOTP。
+func ConfirmTOTPEnrollment(username, code string) error {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	if user.pendingTOTPSecret == "" {
+		return fmt.Errorf("没有待确认的 TOTP 登记，请重新登记")
+	}
+	counter, ok := security.VerifyTOTP(user.pendingTOTPSecret, code, time.Now(), 0)
+	if !ok {
+		return ErrInvalidTOTP
+	}
+	user.TOTPSecret = user.pendingTOTPSecret
+	user.TOTPLastCounter = counter
+	user.pendingTOTPSecret = ""
+	return saveUsersToFile()
+}
+
+// ConsumeTOTP 校验已启用 TOTP 用户的验证码，成功后记录该时间步，防止同一验证码被再次使用。
+func ConsumeTOTP(username, code string) error {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	if !user.TOTPEnabled() {
+		return fmt.Errorf("未启用 TOTP")
+	}
+	counter, ok := security.VerifyTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastCounter)
+	if !ok {
+		return ErrInvalidTOTP
+	}
+	user.TOTPLastCounter = counter
+	return saveUsersToFile()
+}
+
+// DisableTOTP 停用用户的 TOTP。调用方需先通过 ConsumeTOTP 校验验证码。
+func DisableTOTP(username string) error {
+	userMapMutex.Lock()
+	defer userMapMutex.Unlock()
+	user, ok := userMap[username]
+	if !ok {
+		return fmt.Errorf("找不到用户 '%s'", username)
+	}
+	user.TOTPSecret = ""
+	user.TOTPLastCounter = 0
+	user.pendingTOTPSecret = ""
+	return saveUsersToFile()
+}
@@ -0,0 +1,81 @@
+// ===================================================================================
+// File: ddns-server/handler/admin.go
+// Description: 实现管理员接口 HandleAdminLockouts (/admin/lockouts)，用于查看和解除暴力破解锁定。
+// - 使用 server.ini 中 [security] 段的 admin_token 认证，请求头为 "Authorization: Bearer <admin_token>"；未配置时接口不存在 (404)。
+// - GET: 以 JSON 返回所有仍在统计期内的失败记录（用户名和来源IP），正在锁定的排在前面。
+// - DELETE ?user=<username> 或 ?ip=<address>: 清除对应的失败记录，立即解除锁定。
+// 管理员令牌以明文 Bearer 头传输，生产环境请仅通过 HTTPS 访问。错误的管理员令牌同样计入来源IP的认证失败次数，正确的令牌不受锁定影响。
+// ===================================================================================
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+type LockoutsResponse struct {
+	Lockouts []security.LockoutStatus `json:"lockouts"`
+}
+
+func HandleAdminLockouts(w http.ResponseWriter, r *http.Request) {
+	if config.AdminToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !authenticateAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(LockoutsResponse{Lockouts: security.LockoutEntries()}); err != nil {
+			log.Printf("错误: 写回锁定列表失败: %v", err)
+		}
+	case http.MethodDelete:
+		query := r.URL.Query()
+		kind, key := "user", query.Get("user")
+		if key == "" {
+			kind, key = "ip", query.Get("ip")
+		}
+		if key == "" {
+			http.Error(w, "需要提供 user 或 ip 参数", http.StatusBadRequest)
+			return
+		}
+		if !security.UnlockLockout(kind, key) {
+			http.Error(w, "没有找到对应的失败记录", http.StatusNotFound)
+			return
+		}
+		log.Printf("管理员解除了 %s '%s' 的锁定。", kind, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "仅支持 GET 和 DELETE 方法", http.StatusMethodNotAllowed)
+	}
+}
+
+// authenticateAdmin 校验 Bearer 头中的管理员令牌，失败时写回错误响应并返回 false。
+// 正确的管理员令牌不受锁定影响，以便管理员在同一来源IP被锁定时仍能解除锁定；admin_token 至少 24 个字符，无法被穷举。
+func authenticateAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if found && subtle.ConstantTimeCompare([]byte(security.HashToken(token)), []byte(security.HashToken(config.AdminToken))) == 1 {
+		return true
+	}
+	clientIP := security.ClientIP(r)
+	var retryErr retryAfterError
+	if errors.As(security.CheckLockout("", clientIP), &retryErr) {
+		writeTooManyRequests(w, retryErr)
+		return false
+	}
+	log.Printf("管理员接口认证失败: 来源 %s", clientIP)
+	authFailure("", clientIP, nil)
+	w.Header().Set("WWW-Authenticate", `Bearer realm="goddns-admin"`)
+	http.Error(w, "认证失败", http.StatusUnauthorized)
+	return false
+}
@@ -0,0 +1,179 @@
+// ===================================================================================
+// File: ddns-server/handler/apitokens.go
+// Description: 实现 HandleManageAPITokens 函数，处理 /manage-api-tokens 接口，让用户签发、查看和吊销带权限范围的 API 令牌。
+// - create: 签发新令牌，明文令牌只在响应中返回这一次。update 范围的令牌可通过 record/line 限定到一条记录。
+// - list: 列出已签发的令牌（不含明文）。
+// - revoke: 按名称吊销令牌。
+// 只有完整权限的凭据可以管理令牌，因此 update/read 令牌无法为自己提权。
+// ===================================================================================
+package handler
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// maxAPITokenDays 是 API 令牌有效期的上限（天）。
+const maxAPITokenDays = 3650
+
+type APITokenRequest struct {
+	SecretToken   string       `json:"secret_token"`
+	Action        string       `json:"action"` // "list"、"create" 或 "revoke"
+	Name          string       `json:"name,omitempty"`
+	Scope         config.Scope `json:"scope,omitempty"`
+	Record        string       `json:"record,omitempty"`
+	Line          string       `json:"line,omitempty"`
+	ExpiresInDays int          `json:"expires_in_days,omitempty"`
+}
+
+type APITokenView struct {
+	Name      string       `json:"name"`
+	Scope     config.Scope `json:"scope"`
+	Record    string       `json:"record,omitempty"`
+	Line      string       `json:"line,omitempty"`
+	CreatedAt string       `json:"created_at"`
+	ExpiresAt string       `json:"expires_at,omitempty"`
+	Expired   bool         `json:"expired"`
+}
+
+type APITokenListResponse struct {
+	Status string         `json:"status"`
+	Tokens []APITokenView `json:"tokens"`
+}
+
+type APITokenCreateResponse struct {
+	Status    string `json:"status"`
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+func HandleManageAPITokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持 POST 方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req APITokenRequest
+	session, err := AuthenticateAndDecrypt(r, &req, config.ScopeFull)
+	if err != nil {
+		writeAuthError(w, session, err)
+		return
+	}
+
+	switch req.Action {
+	case "list":
+		handleListAPITokens(w, session)
+	case "create":
+		handleCreateAPIToken(w, session, &req)
+	case "revoke":
+		if err := security.ValidateTokenName(req.Name); err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := config.RemoveAPIToken(session.Username, req.Name); err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("成功: 用户 '%s' 吊销了 API 令牌 '%s'。", session.Username, req.Name)
+		writeSecureMessage(w, session, http.StatusOK, "令牌 "+req.Name+" 已吊销")
+	default:
+		writeSecureMessage(w, session, http.StatusBadRequest, "action 必须为 list、create 或 revoke")
+	}
+}
+
+func handleListAPITokens(w http.ResponseWriter, session *Session) {
+	user, _ := config.GetUserByKeyLookup(session.Username)
+	now := time.Now()
+	views := make([]APITokenView, 0, len(user.APITokens))
+	for _, token := range user.APITokens {
+		views = append(views, APITokenView{
+			Name:      token.Name,
+			Scope:     token.Scope,
+			Record:    token.Record,
+			Line:      token.Line,
+			CreatedAt: token.CreatedAt,
+			ExpiresAt: token.ExpiresAt,
+			Expired:   token.Expired(now),
+		})
+	}
+	writeSecureJSON(w, session, http.StatusOK, APITokenListResponse{Status: "success", Tokens: views})
+}
+
+func handleCreateAPIToken(w http.ResponseWriter, session *Session, req *APITokenRequest) {
+	username := session.Username
+	if err := security.ValidateTokenName(req.Name); err != nil {
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !config.ValidScope(req.Scope) {
+		writeSecureMessage(w, session, http.StatusBadRequest, "scope 必须为 update、read 或 full")
+		return
+	}
+	if (req.Record != "" || req.Line != "") && req.Scope != config.ScopeUpdate {
+		writeSecureMessage(w, session, http.StatusBadRequest, "只有 update 范围的令牌可以限定记录或线路")
+		return
+	}
+	if req.Record != "" {
+		rr, zone, ok := config.SplitHostname(req.Record)
+		if !ok {
+			writeSecureMessage(w, session, http.StatusBadRequest, "记录 "+req.Record+" 不在托管域名范围内")
+			return
+		}
+		if err := config.CheckZoneAccess(username, zone, rr); err != nil {
+			writeSecureMessage(w, session, http.StatusForbidden, err.Error())
+			return
+		}
+		req.Record = rr + "." + zone
+	}
+	if req.Line != "" {
+		if err := security.ValidateLine(req.Line); err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPITokenDays {
+		writeSecureMessage(w, session, http.StatusBadRequest, "有效期必须在0到3650天之间 (0 表示永不过期)")
+		return
+	}
+
+	id, err := security.GenerateID(8)
+	if err != nil {
+		log.Printf("错误: 生成 API 令牌失败: %v", err)
+		writeSecureMessage(w, session, http.StatusInternalServerError, "生成令牌时发生内部错误")
+		return
+	}
+	secret, err := security.GenerateToken()
+	if err != nil {
+		log.Printf("错误: 生成 API 令牌失败: %v", err)
+		writeSecureMessage(w, session, http.StatusInternalServerError, "生成令牌时发生内部错误")
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	token := config.APIToken{
+		ID:         id,
+		Name:       req.Name,
+		Scope:      req.Scope,
+		Record:     req.Record,
+		Line:       req.Line,
+		SecretHash: security.HashToken(secret),
+		CreatedAt:  now.Format(time.RFC3339),
+	}
+	if req.ExpiresInDays > 0 {
+		token.ExpiresAt = now.AddDate(0, 0, req.ExpiresInDays).Format(time.RFC3339)
+	}
+	if err := config.AddAPIToken(username, token); err != nil {
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	log.Printf("成功: 用户 '%s' 签发了 API 令牌 '%s' (范围: %s, 记录: %s)。", username, token.Name, token.Scope, token.Record)
+	writeSecureJSON(w, session, http.StatusOK, APITokenCreateResponse{
+		Status:    "success",
+		Token:     config.APITokenPrefix + id + "." + secret,
+		ExpiresAt: token.ExpiresAt,
+	})
+}
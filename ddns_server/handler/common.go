@@ -1,61 +1,308 @@
 // ===================================================================================
 // File: ddns-server/handler/common.go
-// Description: 存放多个处理器都需要用到的通用逻辑，最核心的是 AuthenticateAndDecrypt 函数。这个函数封装了“识别用户 -> 查找密钥 -> 解密数据 -> 认证令牌”这一整套安全流程，极大地简化了其他处理器的代码。
+// Description: 存放多个处理器都需要用到的通用逻辑，最核心的是 AuthenticateAndDecrypt 函数。这个函数封装了“识别用户 -> 查找密钥 -> 解密数据 -> 认证令牌 -> 防重放校验”这一整套安全流程，极大地简化了其他处理器的代码。
+// 启用 mTLS 后，携带映射到该用户 (cert_names) 的有效客户端证书的请求可以省略 SecretToken；由已登记设备 Ed25519 签名的请求同样如此。
+// SecretToken 字段也可以填写用户签发的 API 令牌，此时请求只拥有该令牌的权限范围，处理器通过 requiredScope 声明自己需要的权限。
+// 认证成功后返回的 Session 携带该用户的密钥，处理器通过 writeSecureJSON / writeSecureMessage 将响应以相同的 AES-GCM 信封加密后写回；
+// 认证完成之前发生的错误无法加密，只能以明文返回。
+// 用户不存在、解密失败、令牌或签名不匹配均计为认证失败，按 (用户名, 来源IP) 和来源IP分别统计，失败过多时临时锁定（见 security/lockout.go）。
 // ===================================================================================
 package handler
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/keepsea/goddns/ddns_server/config"
 	"github.com/keepsea/goddns/ddns_server/security"
 )
 
-type BaseRequest struct {
-	Username string `json:"username"`
-	Data     string `json:"data"`
+// MessageResponse 是只包含状态和提示信息的通用响应。
+type MessageResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
 }
 
-type AuthenticatedRequest struct {
-	SecretToken string `json:"secret_token"`
+// replayFields 是每个加密载荷都必须携带的防重放字段。
+type replayFields struct {
+	Timestamp int64  `json:"timestamp"`
+	RequestID string `json:"request_id"`
 }
 
-func AuthenticateAndDecrypt(r *http.Request, targetStruct interface{}) (string, error) {
-	var baseReq BaseRequest
+// Session 表示一次已通过认证的加密请求。method 和 path 用于构造响应的附加认证数据。
+// Device 为签名该请求的已登记设备名，未使用设备签名时为空。
+// rotatedKey / rotatedToken 表示该请求使用了轮换中的新密钥 / 新令牌并触发了提交。
+type Session struct {
+	Username     string
+	Device       string
+	key          []byte
+	rotatedKey   bool
+	rotatedToken bool
+	scope        config.Scope
+	apiToken     *config.APIToken
+	clientIP     string
+	method       string
+	path         string
+}
+
+// credential 描述请求所出示令牌的认证结果。apiToken 仅在使用 API 令牌时非空；pendingSecret 表示匹配的是轮换中的新 secret_token。
+type credential struct {
+	scope         config.Scope
+	apiToken      *config.APIToken
+	pendingSecret bool
+}
+
+// ErrInsufficientScope 表示凭据有效，但其权限范围不允许当前操作。
+var ErrInsufficientScope = errors.New("权限不足")
+
+func AuthenticateAndDecrypt(r *http.Request, targetStruct interface{}, requiredScope config.Scope) (*Session, error) {
+	var baseReq security.Envelope
 	if err := json.NewDecoder(r.Body).Decode(&baseReq); err != nil {
-		return "", fmt.Errorf("请求体JSON格式错误或大小超限")
+		return &Session{}, fmt.Errorf("请求体JSON格式错误或大小超限")
+	}
+	if baseReq.Version != security.EnvelopeVersion {
+		return &Session{}, fmt.Errorf("不支持的加密信封版本 %d，请升级客户端", baseReq.Version)
 	}
 
 	if err := security.ValidateUsername(baseReq.Username); err != nil {
-		return "", err
+		return &Session{}, err
+	}
+	clientIP := security.ClientIP(r)
+	session := &Session{Username: baseReq.Username, clientIP: clientIP, method: r.Method, path: r.URL.Path}
+	if err := security.CheckLockout(baseReq.Username, clientIP); err != nil {
+		return session, err
 	}
 
-	user, ok := config.GetUserByKeyLookup(baseReq.Username)
+	user, ok := lookupUser(baseReq.Username)
 	if !ok {
-		return baseReq.Username, fmt.Errorf("认证失败: 用户 '%s' 不存在", baseReq.Username)
+		return session, authFailure("", clientIP, fmt.Errorf("认证失败: 用户 '%s' 不存在", baseReq.Username))
 	}
 
-	decryptedPayload, err := security.Decrypt([]byte(user.EncryptionKey), baseReq.Data)
+	ad := security.AssociatedData(security.DirectionRequest, baseReq.Username, r.Method, r.URL.Path)
+	if baseReq.Device != "" {
+		device, ok := user.FindDevice(baseReq.Device)
+		if !ok {
+			return session, authFailure(user.Username, clientIP, fmt.Errorf("认证失败: 设备 '%s' 未登记或已被吊销", baseReq.Device))
+		}
+		publicKey, err := security.ParseDevicePublicKey(device.PublicKey)
+		if err != nil || !security.VerifyDeviceSignature(publicKey, security.SigningInput(ad, baseReq.Data), baseReq.Signature) {
+			return session, authFailure(user.Username, clientIP, fmt.Errorf("认证失败: 设备 '%s' 的请求签名无效", baseReq.Device))
+		}
+		session.Device = device.Name
+	}
+
+	// 密钥轮换期间新旧密钥均可解密，响应使用请求所用的密钥加密。
+	key := []byte(user.EncryptionKey)
+	decryptedPayload, err := security.Decrypt(key, baseReq.Data, ad)
+	usedPendingKey := false
+	if err != nil && user.PendingEncryptionKey != "" {
+		key = []byte(user.PendingEncryptionKey)
+		decryptedPayload, err = security.Decrypt(key, baseReq.Data, ad)
+		usedPendingKey = err == nil
+	}
 	if err != nil {
-		return baseReq.Username, fmt.Errorf("请求解密失败")
+		return session, authFailure(user.Username, clientIP, fmt.Errorf("请求解密失败"))
 	}
 
 	if err := json.Unmarshal(decryptedPayload, targetStruct); err != nil {
-		return baseReq.Username, fmt.Errorf("解密后的数据格式错误")
+		return session, fmt.Errorf("解密后的数据格式错误")
 	}
 
 	// Use reflection to get the secret token for authentication
 	v := reflect.ValueOf(targetStruct).Elem().FieldByName("SecretToken")
 	if !v.IsValid() {
-		return baseReq.Username, fmt.Errorf("载荷中缺少SecretToken字段")
+		return session, fmt.Errorf("载荷中缺少SecretToken字段")
+	}
+
+	// 请求由已登记设备签名，或持有映射到该用户的有效客户端证书时，可以省略 SecretToken，并拥有完整权限。
+	cred := credential{scope: config.ScopeFull}
+	if session.Device == "" && !clientCertMatches(r, user) {
+		var ok bool
+		if cred, ok = verifyCredential(user, v.String()); !ok {
+			return session, authFailure(user.Username, clientIP, fmt.Errorf("认证失败: SecretToken不匹配"))
+		}
+	}
+	if !cred.scope.Allows(requiredScope) {
+		return session, fmt.Errorf("%w: 令牌 '%s' 的权限范围为 %s，不允许此操作", ErrInsufficientScope, cred.apiToken.Name, cred.scope)
+	}
+
+	// 按用户限速必须在登记请求ID之前，被限速的请求不占用请求ID，客户端稍后重发同一个请求不会被当作重放。
+	if err := security.AllowUser(user.Username); err != nil {
+		return session, err
+	}
+	var replay replayFields
+	if err := json.Unmarshal(decryptedPayload, &replay); err != nil {
+		return session, fmt.Errorf("解密后的数据格式错误")
+	}
+	if err := security.CheckReplay(user.Username, replay.RequestID, replay.Timestamp); err != nil {
+		return session, err
+	}
+	security.ClearAuthFailures(user.Username, clientIP)
+
+	// 第一个使用新密钥并通过认证的请求证明客户端已保存新密钥，轮换随即自动提交。
+	if usedPendingKey {
+		if err := config.CommitKeyRotation(user.Username); err != nil {
+			log.Printf("警告: 自动提交用户 '%s' 的密钥轮换失败: %v", user.Username, err)
+		} else {
+			log.Printf("用户 '%s' 使用新密钥发起了请求，密钥轮换已自动提交。", user.Username)
+		}
+	}
+
+	if cred.pendingSecret {
+		commitTokenRotation(user.Username)
+	}
+
+	session.key = key
+	session.rotatedKey = usedPendingKey
+	session.rotatedToken = cred.pendingSecret
+	session.scope = cred.scope
+	session.apiToken = cred.apiToken
+	return session, nil
+}
+
+// authFailure 记录一次认证失败并原样返回 err。username 为空时（用户不存在）只计入来源IP，避免任意用户名占满失败记录。
+func authFailure(username, clientIP string, err error) error {
+	if security.RecordAuthFailure(username, clientIP) {
+		log.Printf("警告: 认证失败次数过多，已临时锁定 (用户: %s, 来源: %s)", username, clientIP)
+	}
+	return err
+}
+
+// retryAfterError 是要求客户端稍后重试的错误，即暴力破解锁定 (security.LockoutError) 和按用户限速 (security.RateLimitError)。
+type retryAfterError interface {
+	error
+	RetryAfterSeconds() int
+}
+
+// writeTooManyRequests 以 429 和 Retry-After 头拒绝被锁定或限速的请求。
+func writeTooManyRequests(w http.ResponseWriter, err retryAfterError) {
+	w.Header().Set("Retry-After", strconv.Itoa(err.RetryAfterSeconds()))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
+
+// allowsRecord 判断会话是否可以操作指定记录。只有限定了记录的 update 令牌会受到限制。
+func (s *Session) allowsRecord(domainName, rr, line string) bool {
+	return s.apiToken == nil || s.apiToken.AllowsRecord(domainName, rr, line)
+}
+
+// lookupUser 查找用户，并先完成该用户已过宽限期的密钥/令牌轮换，使过期的旧凭据不再被接受。
+func lookupUser(username string) (config.User, bool) {
+	user, ok := config.GetUserByKeyLookup(username)
+	if !ok || !user.RotationDue(time.Now()) {
+		return user, ok
+	}
+	if _, err := config.ExpireRotations(username); err != nil {
+		log.Printf("警告: 完成用户 '%s' 已到期的凭据轮换失败: %v", username, err)
+	}
+	return config.GetUserByKeyLookup(username)
+}
+
+// verifyCredential 校验请求出示的令牌：以 "gdt_" 开头的视为 API 令牌，否则按 secret_token 校验。
+func verifyCredential(user config.User, token string) (credential, bool) {
+	if id, secret, ok := config.SplitAPIToken(token); ok {
+		apiToken, found := user.FindAPIToken(id)
+		if !found || apiToken.Expired(time.Now()) {
+			return credential{}, false
+		}
+		if subtle.ConstantTimeCompare([]byte(security.HashToken(secret)), []byte(apiToken.SecretHash)) != 1 {
+			return credential{}, false
+		}
+		return credential{scope: apiToken.Scope, apiToken: &apiToken}, true
+	}
+	ok, pending := verifySecretToken(user, token)
+	return credential{scope: config.ScopeFull, pendingSecret: pending}, ok
+}
+
+// verifySecretToken 校验用户的 secret_token，所有认证入口（加密载荷、HTTP Basic）都应通过 verifyCredential 间接调用它。
+// 令牌轮换期间新旧令牌均有效，pending 表示匹配的是轮换中的新令牌，调用方应在请求通过其他校验后调用 commitTokenRotation。
+// 只有当前令牌不匹配且确有进行中的轮换时才会校验新令牌的哈希，每次认证最多计算两次 PBKDF2。
+func verifySecretToken(user config.User, token string) (ok bool, pending bool) {
+	if security.VerifySecret(user.SecretTokenHash, token) {
+		return true, false
+	}
+	if user.PendingSecretTokenHash != "" && security.VerifySecret(user.PendingSecretTokenHash, token) {
+		return true, true
+	}
+	return false, false
+}
+
+// commitTokenRotation 在收到第一个使用新令牌的请求后提交令牌轮换。
+func commitTokenRotation(username string) {
+	if err := config.CommitTokenRotation(username); err != nil {
+		log.Printf("警告: 自动提交用户 '%s' 的令牌轮换失败: %v", username, err)
+		return
 	}
+	log.Printf("用户 '%s' 使用新令牌发起了请求，令牌轮换已自动提交。", username)
+}
 
-	if user.SecretToken != v.String() {
-		return baseReq.Username, fmt.Errorf("认证失败: SecretToken不匹配")
+// clientCertMatches 判断请求携带的已验证客户端证书是否映射到该用户 (users.json 中的 cert_names)。
+func clientCertMatches(r *http.Request, user config.User) bool {
+	for _, identity := range security.CertIdentities(r) {
+		for _, name := range user.CertNames {
+			if identity == name {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	return baseReq.Username, nil
+// writeSecureJSON 将 v 序列化后用会话密钥加密，以 security.Envelope 的形式写回。
+// 会话尚未完成认证（没有可用密钥）时退化为明文错误响应。
+func writeSecureJSON(w http.ResponseWriter, session *Session, status int, v interface{}) {
+	if session == nil || session.key == nil {
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("错误: 序列化用户 '%s' 的响应失败: %v", session.Username, err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	ad := security.AssociatedData(security.DirectionResponse, session.Username, session.method, session.path)
+	encrypted, err := security.Encrypt(session.key, plaintext, ad)
+	if err != nil {
+		log.Printf("错误: 加密用户 '%s' 的响应失败: %v", session.Username, err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(security.Envelope{Version: security.EnvelopeVersion, Data: encrypted}); err != nil {
+		log.Printf("错误: 写回用户 '%s' 的响应失败: %v", session.Username, err)
+	}
+}
+
+// writeSecureMessage 写回加密的状态信息。status 为 200 时状态为 success，否则为 error。
+func writeSecureMessage(w http.ResponseWriter, session *Session, status int, message string) {
+	resp := MessageResponse{Status: "success", Message: message}
+	if status != http.StatusOK {
+		resp.Status = "error"
+	}
+	writeSecureJSON(w, session, status, resp)
+}
+
+// writeAuthError 写回认证阶段的错误。此时尚未确认请求者的身份，只能以明文返回。
+// 重放和过期请求使用 409 状态码，以便与普通认证失败区分；被锁定或限速的请求使用 429 并附带 Retry-After。
+func writeAuthError(w http.ResponseWriter, session *Session, err error) {
+	var retryErr retryAfterError
+	if errors.As(err, &retryErr) {
+		writeTooManyRequests(w, retryErr)
+		log.Printf("请求处理失败 (用户: %s): %v", session.Username, err)
+		return
+	}
+	status := http.StatusForbidden
+	if errors.Is(err, security.ErrReplayedRequest) || errors.Is(err, security.ErrStaleRequest) {
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+	log.Printf("请求处理失败 (用户: %s): %v", session.Username, err)
 }
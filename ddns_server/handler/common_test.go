@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+func TestVerifySecretTokenDuringRotation(t *testing.T) {
+	loadTestUsers(t, `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`"}]}`)
+	newHash, err := security.HashSecret("tok-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.BeginTokenRotation("alice", newHash); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := config.GetUserByKeyLookup("alice")
+
+	tests := []struct {
+		token       string
+		ok, pending bool
+	}{
+		{"tok", true, false},
+		{"tok-new", true, true},
+		{"wrong", false, false},
+	}
+	for _, tt := range tests {
+		if ok, pending := verifySecretToken(user, tt.token); ok != tt.ok || pending != tt.pending {
+			t.Errorf("verifySecretToken(%q) = %v, %v, want %v, %v", tt.token, ok, pending, tt.ok, tt.pending)
+		}
+	}
+
+	// 使用新令牌的请求会自动提交轮换，之后旧令牌失效。
+	commitTokenRotation("alice")
+	user, _ = config.GetUserByKeyLookup("alice")
+	if ok, _ := verifySecretToken(user, "tok"); ok {
+		t.Error("提交轮换后旧令牌应失效")
+	}
+	if ok, pending := verifySecretToken(user, "tok-new"); !ok || pending {
+		t.Error("提交轮换后新令牌应作为当前令牌生效")
+	}
+}
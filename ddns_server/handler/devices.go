@@ -0,0 +1,99 @@
+// ===================================================================================
+// File: ddns-server/handler/devices.go
+// Description: 实现 HandleManageDevices 函数，处理 /manage-devices 接口，用于管理用户登记的设备。
+// - list: 列出已登记的设备。
+// - enroll: 登记一台新设备及其 Ed25519 公钥，之后该设备可用私钥签名请求代替 secret_token。
+// - revoke: 吊销一台设备，只影响这一台设备，其他设备无需任何改动。
+// ===================================================================================
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+type DeviceRequest struct {
+	SecretToken string `json:"secret_token"`
+	Action      string `json:"action"` // "list"、"enroll" 或 "revoke"
+	Name        string `json:"name,omitempty"`
+	PublicKey   string `json:"public_key,omitempty"`
+}
+
+type DeviceView struct {
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint"`
+	CreatedAt   string `json:"created_at"`
+}
+
+type DeviceListResponse struct {
+	Status  string       `json:"status"`
+	Devices []DeviceView `json:"devices"`
+}
+
+func HandleManageDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持 POST 方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DeviceRequest
+	session, err := AuthenticateAndDecrypt(r, &req, config.ScopeFull)
+	if err != nil {
+		writeAuthError(w, session, err)
+		return
+	}
+	username := session.Username
+
+	switch req.Action {
+	case "list":
+		user, _ := config.GetUserByKeyLookup(username)
+		views := make([]DeviceView, 0, len(user.Devices))
+		for _, device := range user.Devices {
+			views = append(views, DeviceView{Name: device.Name, Fingerprint: devicePublicKeyFingerprint(device.PublicKey), CreatedAt: device.CreatedAt})
+		}
+		writeSecureJSON(w, session, http.StatusOK, DeviceListResponse{Status: "success", Devices: views})
+	case "enroll":
+		if err := security.ValidateDeviceName(req.Name); err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, err := security.ParseDevicePublicKey(req.PublicKey); err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := config.AddUserDevice(username, req.Name, req.PublicKey); err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("成功: 用户 '%s' 登记了设备 '%s' (指纹: %s)。", username, req.Name, devicePublicKeyFingerprint(req.PublicKey))
+		writeSecureMessage(w, session, http.StatusOK, "设备 "+req.Name+" 已登记")
+	case "revoke":
+		if err := security.ValidateDeviceName(req.Name); err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := config.RemoveUserDevice(username, req.Name); err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("成功: 用户 '%s' 吊销了设备 '%s'。", username, req.Name)
+		writeSecureMessage(w, session, http.StatusOK, "设备 "+req.Name+" 已吊销")
+	default:
+		writeSecureMessage(w, session, http.StatusBadRequest, "action 必须为 list、enroll 或 revoke")
+	}
+}
+
+// devicePublicKeyFingerprint 返回公钥 SHA-256 摘要的前 16 位十六进制，便于用户与客户端登记时的输出核对。
+func devicePublicKeyFingerprint(publicKey string) string {
+	key, err := security.ParseDevicePublicKey(publicKey)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,151 @@
+// ===================================================================================
+// File: ddns-server/handler/dyndns.go
+// Description: 实现 HandleDynDNSUpdate 函数，提供与 dyndns2 协议兼容的 /nic/update 接口，供路由器（OpenWrt、pfSense、FRITZ!Box、UniFi）以及 ddclient、inadyn 等标准客户端直接使用。
+// - 使用 HTTP Basic 认证，用户名和密码分别对应 users.json 中的 username 和 secret_token；携带映射到该用户的客户端证书时密码可留空。
+// - 密码也可以是 update 或 full 范围的 API 令牌，限定了记录的令牌只能更新该记录。
+// - hostname 参数支持以逗号分隔的多个完整域名，myip 缺省时使用请求的来源地址。
+// - 每个域名都通过 performUpdate 执行，与 /update-dns 共用额度、域名策略和所有权规则。
+// - 认证失败与加密接口一并计入暴力破解统计，被锁定、超出用户限速或被中间件按IP限速时都返回 abuse (429，附带 Retry-After)；被来源网络限制拒绝时同样返回 abuse，以便与凭据错误的 badauth 区分。
+// - 按协议返回纯文本的 good / nochg / badauth / nohost / notfqdn / abuse / dnserr / 911，每个域名一行。
+// ===================================================================================
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// maxDynDNSHosts 限制单次请求可更新的域名数量。
+const maxDynDNSHosts = 20
+
+func HandleDynDNSUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "仅支持 GET 和 POST 方法", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="goddns"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "badauth")
+		return
+	}
+	clientIP := security.ClientIP(r)
+	if err := security.ValidateUsername(username); err != nil {
+		authFailure("", clientIP, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "badauth")
+		return
+	}
+	var retryErr retryAfterError
+	if errors.As(security.CheckLockout(username, clientIP), &retryErr) {
+		log.Printf("dyndns2 拒绝 (用户: %s, 来源: %s): %v", username, clientIP, retryErr)
+		writeAbuse(w, retryErr)
+		return
+	}
+	user, exists := lookupUser(username)
+	ok = exists
+	cred := credential{scope: config.ScopeFull}
+	if exists && !clientCertMatches(r, user) {
+		cred, ok = verifyCredential(user, password)
+	}
+	if !ok {
+		failedUser := ""
+		if exists {
+			failedUser = username
+		}
+		authFailure(failedUser, clientIP, nil)
+	}
+	if !ok || !cred.scope.Allows(config.ScopeUpdate) {
+		log.Printf("dyndns2 认证失败 (用户: %s)", username)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "badauth")
+		return
+	}
+	security.ClearAuthFailures(username, clientIP)
+	if errors.As(security.AllowUser(username), &retryErr) {
+		log.Printf("dyndns2 拒绝 (用户: %s): %v", username, retryErr)
+		writeAbuse(w, retryErr)
+		return
+	}
+	if cred.pendingSecret {
+		commitTokenRotation(username)
+	}
+
+	query := r.URL.Query()
+	var hostnames []string
+	for _, h := range strings.Split(query.Get("hostname"), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hostnames = append(hostnames, h)
+		}
+	}
+	if len(hostnames) == 0 || len(hostnames) > maxDynDNSHosts {
+		fmt.Fprintln(w, "notfqdn")
+		return
+	}
+
+	myIP := dynDNSAddress(query.Get("myip"))
+	if myIP == "" {
+		myIP = clientIP
+	}
+
+	for _, hostname := range hostnames {
+		fmt.Fprintln(w, dynDNSUpdateHost(username, cred.apiToken, clientIP, hostname, myIP))
+	}
+}
+
+// dynDNSUpdateHost 更新单个域名并返回 dyndns2 协议的结果行。
+// apiToken 非空时，只允许更新该令牌限定的记录。sourceIP 为请求的来源地址，用于检查来源网络限制。
+func dynDNSUpdateHost(username string, apiToken *config.APIToken, sourceIP, hostname, ip string) string {
+	rr, zone, ok := config.SplitHostname(hostname)
+	if !ok {
+		return "nohost"
+	}
+	if apiToken != nil && !apiToken.AllowsRecord(zone, rr, config.DefaultLine) {
+		log.Printf("dyndns2 拒绝: 用户 '%s' 的令牌 '%s' 不能更新 %s", username, apiToken.Name, hostname)
+		return "nohost"
+	}
+	changed, _, uerr := performUpdate(username, apiToken, sourceIP, &UpdateRequest{DomainName: zone, RR: rr, NewIP: ip})
+	if uerr != nil {
+		log.Printf("dyndns2 更新失败 (用户: %s, 域名: %s): %v", username, hostname, uerr)
+		return uerr.Code
+	}
+	if changed {
+		return "good " + ip
+	}
+	return "nochg " + ip
+}
+
+// writeAbuse 以 dyndns2 协议的 abuse 拒绝被锁定或限速的请求，并通过 Retry-After 告知需要等待的时间。
+func writeAbuse(w http.ResponseWriter, err retryAfterError) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Retry-After", strconv.Itoa(err.RetryAfterSeconds()))
+	w.WriteHeader(http.StatusTooManyRequests)
+	fmt.Fprintln(w, "abuse")
+}
+
+// WriteRateLimitAbuse 供 RateLimit 中间件使用 (security.SetRateLimitResponder)，使 /nic/update 和 /u/ 被按IP限速时同样返回 abuse。
+func WriteRateLimitAbuse(w http.ResponseWriter, err *security.RateLimitError) {
+	writeAbuse(w, err)
+}
+
+// dynDNSAddress 从 myip 参数中取出第一个IPv4地址。部分客户端会以逗号分隔同时上报IPv4和IPv6地址。
+func dynDNSAddress(myIP string) string {
+	for _, candidate := range strings.Split(myIP, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if ip := net.ParseIP(candidate); ip != nil && ip.To4() != nil {
+			return candidate
+		}
+	}
+	return strings.TrimSpace(myIP)
+}
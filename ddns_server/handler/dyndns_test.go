@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// dynDNSRequest 以 Basic 认证从 remoteAddr 调用 /nic/update，返回状态码和去除首尾空白的响应体。
+func dynDNSRequest(t *testing.T, remoteAddr, username, password, query string) (int, string, http.Header) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/nic/update?"+query, nil)
+	r.RemoteAddr = remoteAddr
+	if username != "" {
+		r.SetBasicAuth(username, password)
+	}
+	w := httptest.NewRecorder()
+	HandleDynDNSUpdate(w, r)
+	return w.Code, strings.TrimSpace(w.Body.String()), w.Header()
+}
+
+// disableUserRateLimit 关闭按用户限速，避免重复运行测试 (-count) 时耗尽同一用户的令牌桶，测试结束后恢复默认策略。
+func disableUserRateLimit(t *testing.T) {
+	t.Helper()
+	security.SetRateLimits(security.RateRule{}, nil, security.RateRule{}, nil, 10*time.Minute, 100000)
+	t.Cleanup(func() {
+		security.SetRateLimits(security.RateRule{PerMinute: 12, Burst: 5}, nil, security.RateRule{PerMinute: 30, Burst: 10}, nil, 10*time.Minute, 100000)
+	})
+}
+
+func TestDynDNSResponseCodes(t *testing.T) {
+	loadTestUsers(t, `{"users":[
+		{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`","domain_limit":2},
+		{"username":"carol","secret_token":"tok","encryption_key":"`+testKey+`","source_cidrs":["198.51.100.0/24"]}]}`)
+	setTestZones(t, "www")
+	disableUserRateLimit(t)
+	t.Cleanup(func() { security.UnlockLockout("user", "alice") })
+
+	tests := []struct {
+		name, remote, username, password, query string
+		status                                  int
+		body                                    string
+	}{
+		{"缺少认证", "192.0.2.10:1234", "", "", "hostname=home.example.com", http.StatusUnauthorized, "badauth"},
+		{"密码错误", "192.0.2.11:1234", "alice", "wrong", "hostname=home.example.com", http.StatusUnauthorized, "badauth"},
+		{"用户不存在", "192.0.2.12:1234", "nobody", "tok", "hostname=home.example.com", http.StatusUnauthorized, "badauth"},
+		{"缺少域名", "192.0.2.13:1234", "alice", "tok", "", http.StatusOK, "notfqdn"},
+		{"非托管域名", "192.0.2.14:1234", "alice", "tok", "hostname=home.other.com&myip=8.8.8.8", http.StatusOK, "nohost"},
+		{"保留名称", "192.0.2.15:1234", "alice", "tok", "hostname=www.example.com&myip=8.8.8.8", http.StatusOK, "nohost"},
+		{"无效地址", "192.0.2.16:1234", "alice", "tok", "hostname=home.example.com&myip=bogus", http.StatusOK, "dnserr"},
+		{"来源网络限制", "192.0.2.17:1234", "carol", "tok", "hostname=home.example.com&myip=8.8.8.8", http.StatusOK, "abuse"},
+	}
+	for _, tt := range tests {
+		status, body, _ := dynDNSRequest(t, tt.remote, tt.username, tt.password, tt.query)
+		if status != tt.status || body != tt.body {
+			t.Errorf("%s: 响应 = %d %q, want %d %q", tt.name, status, body, tt.status, tt.body)
+		}
+	}
+
+	// 每个域名一行结果
+	_, body, _ := dynDNSRequest(t, "192.0.2.18:1234", "alice", "tok", "hostname=www.example.com,home.other.com&myip=8.8.8.8")
+	if body != "nohost\nnohost" {
+		t.Errorf("多个域名的响应 = %q", body)
+	}
+}
+
+func TestDynDNSLockoutReturnsAbuse(t *testing.T) {
+	loadTestUsers(t, `{"users":[{"username":"dave","secret_token":"tok","encryption_key":"`+testKey+`"}]}`)
+	setTestZones(t)
+
+	const remote = "192.0.2.30:1234"
+	t.Cleanup(func() {
+		security.UnlockLockout("user", "dave")
+		security.UnlockLockout("ip", "192.0.2.30")
+	})
+	for i := 0; i < 5; i++ {
+		if status, body, _ := dynDNSRequest(t, remote, "dave", "wrong", "hostname=home.example.com"); body != "badauth" {
+			t.Fatalf("第 %d 次失败: 响应 = %d %q, want badauth", i+1, status, body)
+		}
+	}
+	// 被锁定后即使密码正确也返回 abuse，并告知重试时间
+	status, body, header := dynDNSRequest(t, remote, "dave", "tok", "hostname=home.example.com")
+	if status != http.StatusTooManyRequests || body != "abuse" || header.Get("Retry-After") == "" {
+		t.Fatalf("锁定后响应 = %d %q (Retry-After: %q), want 429 abuse", status, body, header.Get("Retry-After"))
+	}
+}
@@ -0,0 +1,87 @@
+// ===================================================================================
+// File: ddns-server/handler/geo.go
+// Description: 将每次成功的更新（地址、来源地址、来源国家 / ASN、API 令牌）写入记录历史，并在来源国家发生变化时发出告警。
+// - 告警总是写入服务端日志；配置了 server.ini 中 [geoip] 段的 alert_log 时，同时以 JSON 行的形式追加到该文件，便于运维系统采集。
+// - 任一次来源的国家未知（未加载国家数据库或查不到）时不告警。
+// ===================================================================================
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// geoAlert 是写入 alert_log 的一行告警。
+type geoAlert struct {
+	Time     string             `json:"time"`
+	User     string             `json:"user"`
+	Record   string             `json:"record"`
+	Token    string             `json:"token,omitempty"`
+	SourceIP string             `json:"source_ip"`
+	Geo      security.GeoInfo   `json:"geo"`
+	Previous config.RecordEvent `json:"previous"`
+}
+
+var geoAlertMutex = &sync.Mutex{}
+
+// recordUpdateEvent 写入记录历史，失败只记录日志，不影响已完成的更新。
+func recordUpdateEvent(username string, apiToken *config.APIToken, sourceIP string, geo security.GeoInfo, req *UpdateRequest) {
+	event := config.RecordEvent{
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		IP:       req.NewIP,
+		SourceIP: sourceIP,
+		GeoInfo:  geo,
+	}
+	if apiToken != nil {
+		event.Token = apiToken.Name
+	}
+	previous, hasPrevious, err := config.AppendRecordEvent(username, req.DomainName, req.RR, req.Line, event)
+	if err != nil {
+		log.Printf("警告: 写入用户 '%s' 的记录 %s.%s 的更新历史失败: %v", username, req.RR, req.DomainName, err)
+		return
+	}
+	if !hasPrevious || previous.Country == "" || geo.Country == "" || previous.Country == geo.Country {
+		return
+	}
+
+	alert := geoAlert{
+		Time:     event.Time,
+		User:     username,
+		Record:   req.RR + "." + req.DomainName,
+		Token:    event.Token,
+		SourceIP: sourceIP,
+		Geo:      geo,
+		Previous: previous,
+	}
+	log.Printf("告警: 用户 '%s' 的记录 %s 的更新来源国家由 %s (%s) 变为 %s (%s)，令牌: '%s'", username, alert.Record, previous.Country, previous.SourceIP, geo.Country, sourceIP, event.Token)
+	writeGeoAlert(alert)
+}
+
+// writeGeoAlert 将告警以 JSON 行追加到 alert_log 文件。
+func writeGeoAlert(alert geoAlert) {
+	if config.GeoIPAlertLog == "" {
+		return
+	}
+	line, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("警告: 序列化告警失败: %v", err)
+		return
+	}
+	geoAlertMutex.Lock()
+	defer geoAlertMutex.Unlock()
+	f, err := os.OpenFile(config.GeoIPAlertLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("警告: 打开告警日志 %s 失败: %v", config.GeoIPAlertLog, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("警告: 写入告警日志 %s 失败: %v", config.GeoIPAlertLog, err)
+	}
+}
@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"os"
+	"testing"
+
+	"github.com/keepsea/goddns/ddns_server/config"
+)
+
+// testKey 是测试用户的 encryption_key (32 字节)。
+const testKey = "0123456789abcdef0123456789abcdef"
+
+// loadTestUsers 在临时目录中写入 users.json、切换到该目录并加载。
+func loadTestUsers(t *testing.T, content string) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(config.UsersConfigFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadUsers(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,87 +1,123 @@
 // ===================================================================================
 // File: ddns-server/handler/key.go
-// Description: 实现 HandleManageKey 函数，负责处理用户对加密密钥的自助管理。它同样会根据HTTP请求的方法，分发到handleViewKey（查看密钥）或handleResetKey（重置密钥）的逻辑。
+// Description: 实现 HandleManageKey 函数，负责处理用户对加密密钥的自助管理。所有操作都使用加密的 POST 请求，并根据载荷中的 action 分发：
+// - view: 查看当前请求所用的密钥。
+// - rotate: 开始两阶段密钥轮换，登记新密钥；宽限期内新旧密钥均有效。启用了 TOTP 的用户需要提供验证码。
+// - commit: 使用新密钥发送，确认客户端已保存新密钥（任何使用新密钥的请求都会自动提交）。
+// - abort: 使用旧密钥发送，放弃轮换。
 // ===================================================================================
 package handler
 
 import (
-	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/keepsea/goddns/ddns_server/config"
-	"github.com/keepsea/goddns/ddns_server/security"
 )
 
 type KeyViewResponse struct {
+	Status        string `json:"status"`
 	EncryptionKey string `json:"encryption_key"`
 }
 
-type KeyResetRequest struct {
+type KeyRequest struct {
 	SecretToken      string `json:"secret_token"`
-	NewEncryptionKey string `json:"new_encryption_key"`
+	Action           string `json:"action"` // "view"、"rotate"、"commit" 或 "abort"
+	NewEncryptionKey string `json:"new_encryption_key,omitempty"`
+	TOTPCode         string `json:"totp_code,omitempty"`
+}
+
+type RotationResponse struct {
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	ExpiresAt string `json:"expires_at"`
 }
 
 func HandleManageKey(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet && r.Method != http.MethodPost {
-		http.Error(w, "仅支持 GET 和 POST 方法", http.StatusMethodNotAllowed)
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持 POST 方法", http.StatusMethodNotAllowed)
 		return
 	}
-	if r.Method == http.MethodGet {
-		handleViewKey(w, r)
-	} else {
-		handleResetKey(w, r)
+
+	var req KeyRequest
+	session, err := AuthenticateAndDecrypt(r, &req, config.ScopeFull)
+	if err != nil {
+		writeAuthError(w, session, err)
+		return
 	}
+
+	switch req.Action {
+	case "view":
+		handleViewKey(w, session)
+	case "rotate":
+		handleRotateKey(w, session, &req)
+	case "commit":
+		handleCommitKey(w, session)
+	case "abort":
+		handleAbortKey(w, session)
+	default:
+		writeSecureMessage(w, session, http.StatusBadRequest, "action 必须为 view、rotate、commit 或 abort")
+	}
+}
+
+func handleViewKey(w http.ResponseWriter, session *Session) {
+	writeSecureJSON(w, session, http.StatusOK, KeyViewResponse{Status: "success", EncryptionKey: string(session.key)})
+	log.Printf("用户 '%s' 查询了其加密密钥。", session.Username)
 }
 
-func handleViewKey(w http.ResponseWriter, r *http.Request) {
-	username := r.URL.Query().Get("username")
-	if err := security.ValidateUsername(username); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+func handleRotateKey(w http.ResponseWriter, session *Session, req *KeyRequest) {
+	username := session.Username
+	if session.rotatedKey {
+		writeSecureMessage(w, session, http.StatusConflict, "上一次密钥轮换刚刚提交，请使用当前密钥重新发起轮换")
 		return
 	}
-	user, ok := config.GetUserByKeyLookup(username)
-	if !ok {
-		http.Error(w, "认证失败: 用户不存在", http.StatusUnauthorized)
+	if len(req.NewEncryptionKey) != 32 {
+		writeSecureMessage(w, session, http.StatusBadRequest, "新密钥长度必须为32个字符")
 		return
 	}
-	token := r.Header.Get("Authorization")
-	if token != "Bearer "+user.SecretToken {
-		http.Error(w, "认证失败: 令牌不匹配", http.StatusUnauthorized)
+
+	if !requireTOTP(w, session, req.TOTPCode) {
 		return
 	}
 
-	resp := KeyViewResponse{EncryptionKey: user.EncryptionKey}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		log.Printf("错误: 序列化用户 '%s' 的密钥失败: %v", user.Username, err)
-		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+	expiresAt, err := config.BeginKeyRotation(username, req.NewEncryptionKey)
+	if err != nil {
+		log.Printf("错误: 用户 '%s' 开始密钥轮换失败: %v", username, err)
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
 	}
-	log.Printf("用户 '%s' 查询了其加密密钥。", user.Username)
+
+	log.Printf("用户 '%s' 开始了密钥轮换，旧密钥将于 %s 过期。", username, expiresAt.Format(time.RFC3339))
+	writeSecureJSON(w, session, http.StatusOK, RotationResponse{
+		Status:    "success",
+		Message:   "新密钥已登记，请使用新密钥确认",
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	})
 }
 
-func handleResetKey(w http.ResponseWriter, r *http.Request) {
-	var req KeyResetRequest
-	username, err := AuthenticateAndDecrypt(r, &req)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusForbidden)
-		log.Printf("请求处理失败 (用户: %s): %v", username, err)
+func handleCommitKey(w http.ResponseWriter, session *Session) {
+	if session.rotatedKey {
+		writeSecureMessage(w, session, http.StatusOK, "密钥轮换已提交，旧密钥已作废。")
 		return
 	}
-
-	if len(req.NewEncryptionKey) != 32 {
-		http.Error(w, "新密钥长度必须为32个字符", http.StatusBadRequest)
+	user, _ := config.GetUserByKeyLookup(session.Username)
+	if user.PendingEncryptionKey == "" {
+		writeSecureMessage(w, session, http.StatusBadRequest, "当前没有进行中的密钥轮换")
 		return
 	}
+	writeSecureMessage(w, session, http.StatusBadRequest, "commit 请求必须使用新密钥加密")
+}
 
-	if err := config.UpdateUserKey(username, req.NewEncryptionKey); err != nil {
-		log.Printf("错误: 用户 '%s' 更新加密密钥失败: %v", username, err)
-		http.Error(w, "更新密钥时发生内部错误", http.StatusInternalServerError)
+func handleAbortKey(w http.ResponseWriter, session *Session) {
+	if session.rotatedKey {
+		writeSecureMessage(w, session, http.StatusConflict, "该请求使用了新密钥，密钥轮换已提交，无法放弃")
 		return
 	}
-
-	msg := "加密密钥已成功重置。"
-	log.Printf("成功: 用户 '%s' %s", username, msg)
-	fmt.Fprintf(w, `{"status":"success", "message":"%s"}`, msg)
+	if err := config.AbortKeyRotation(session.Username); err != nil {
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("用户 '%s' 放弃了密钥轮换。", session.Username)
+	writeSecureMessage(w, session, http.StatusOK, "密钥轮换已放弃，继续使用旧密钥。")
 }
@@ -1,14 +1,14 @@
 // ===================================================================================
 // File: ddns-server/handler/records.go
-// Description: 实现 HandleManageRecords 函数，负责处理用户对域名记录的自助管理。它会根据HTTP请求的方法（GET或DELETE），分别调用内部的handleList（查看）或handleDelete（删除）逻辑。
+// Description: 实现 HandleManageRecords 函数，负责处理用户对域名记录的自助管理。它会根据HTTP请求的方法（POST或DELETE），分别调用内部的handleList（查看）或handleDelete（删除）逻辑。两者都使用加密请求，响应同样加密返回。
 // ===================================================================================
 package handler
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/keepsea/goddns/ddns_server/aliyun"
 	"github.com/keepsea/goddns/ddns_server/config"
@@ -19,15 +19,31 @@ type ManageRequest struct {
 	SecretToken string `json:"secret_token"`
 	DomainName  string `json:"domain_name,omitempty"`
 	RR          string `json:"rr,omitempty"`
+	Line        string `json:"line,omitempty"`
+	TOTPCode    string `json:"totp_code,omitempty"`
+}
+
+// RecordView 是返回给用户的记录信息，不包含 RecordID 和令牌摘要等内部字段。
+type RecordView struct {
+	DomainName     string `json:"domain_name"`
+	RR             string `json:"rr"`
+	Line           string `json:"line"`
+	Paused         bool   `json:"paused"`
+	HasUpdateToken bool   `json:"has_update_token"`
+}
+
+type RecordListResponse struct {
+	Status  string       `json:"status"`
+	Records []RecordView `json:"records"`
 }
 
 func HandleManageRecords(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
-		http.Error(w, "仅支持 GET 和 DELETE 方法", http.StatusMethodNotAllowed)
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "仅支持 POST 和 DELETE 方法", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if r.Method == http.MethodGet {
+	if r.Method == http.MethodPost {
 		handleList(w, r)
 	} else {
 		handleDelete(w, r)
@@ -35,76 +51,101 @@ func HandleManageRecords(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleList(w http.ResponseWriter, r *http.Request) {
-	username := r.URL.Query().Get("username")
-	if err := security.ValidateUsername(username); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var req ManageRequest
+	session, err := AuthenticateAndDecrypt(r, &req, config.ScopeRead)
+	if err != nil {
+		writeAuthError(w, session, err)
 		return
 	}
 
-	// For GET, we cannot read the body for token.
-	// The auth must be done via header.
-	user, ok := config.GetUserByKeyLookup(username)
+	user, ok := config.GetUserByKeyLookup(session.Username)
 	if !ok {
-		http.Error(w, "认证失败: 用户不存在", http.StatusUnauthorized)
-		return
-	}
-	token := r.Header.Get("Authorization")
-	if token != "Bearer "+user.SecretToken {
-		http.Error(w, "认证失败: 令牌不匹配", http.StatusUnauthorized)
+		writeSecureMessage(w, session, http.StatusUnauthorized, "认证失败: 用户不存在")
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(user.Records); err != nil {
-		log.Printf("错误: 序列化用户 '%s' 的记录列表失败: %v", user.Username, err)
-		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+	resp := RecordListResponse{Status: "success", Records: []RecordView{}}
+	for _, record := range user.Records {
+		resp.Records = append(resp.Records, RecordView{
+			DomainName:     record.DomainName,
+			RR:             record.RR,
+			Line:           record.EffectiveLine(),
+			Paused:         record.Paused,
+			HasUpdateToken: record.UpdateTokenHash != "",
+		})
 	}
+	writeSecureJSON(w, session, http.StatusOK, resp)
 	log.Printf("用户 '%s' 查询了其域名列表。", user.Username)
 }
 
 func handleDelete(w http.ResponseWriter, r *http.Request) {
 	var req ManageRequest
-	username, err := AuthenticateAndDecrypt(r, &req)
+	session, err := AuthenticateAndDecrypt(r, &req, config.ScopeFull)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusForbidden)
-		log.Printf("请求处理失败 (用户: %s): %v", username, err)
+		writeAuthError(w, session, err)
 		return
 	}
+	username := session.Username
 
 	if err := security.ValidateDomain(req.DomainName); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
 		return
 	}
 	if err := security.ValidateRR(req.RR); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := config.CheckZoneAccess(username, req.DomainName, req.RR); err != nil {
+		log.Printf("拒绝: 用户 '%s' 操作 %s.%s 被域名策略拒绝: %v", username, req.RR, req.DomainName, err)
+		writeSecureMessage(w, session, http.StatusForbidden, err.Error())
 		return
 	}
 
-	recordID, err := config.UnbindRecordFromUser(username, req.DomainName, req.RR)
-	if err != nil {
-		log.Printf("错误: 用户 '%s' 注销域名失败: %v", username, err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if req.Line != "" {
+		if err := security.ValidateLine(req.Line); err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// 注销后域名可被任何人注册，启用了 TOTP 的用户需要提供验证码。
+	if !requireTOTP(w, session, req.TOTPCode) {
 		return
 	}
-	if recordID == "" {
-		log.Printf("警告: 用户 '%s' 尝试删除的域名 %s.%s 没有关联的 RecordID，仅从本地配置中移除。", username, req.RR, req.DomainName)
-		fmt.Fprintf(w, `{"status":"success", "message":"域名已从配置中移除，但阿里云端无对应记录可删除。"}`)
+
+	records := config.FindUserRecords(username, req.DomainName, req.RR, req.Line)
+	if len(records) == 0 {
+		writeSecureMessage(w, session, http.StatusBadRequest, fmt.Sprintf("您名下未找到域名 %s.%s", req.RR, req.DomainName))
 		return
 	}
 
 	client, err := aliyun.CreateClient()
 	if err != nil {
 		log.Printf("错误: 创建阿里云客户端失败: %v", err)
-		http.Error(w, "服务端配置错误", http.StatusInternalServerError)
+		writeSecureMessage(w, session, http.StatusInternalServerError, "服务端配置错误")
 		return
 	}
-	if err := aliyun.DeleteDomainRecord(client, recordID); err != nil {
-		log.Printf("严重警告: 从配置中移除了用户 '%s' 的域名 %s.%s，但在阿里云删除失败: %v", username, req.RR, req.DomainName, err)
-		http.Error(w, fmt.Sprintf("域名已从配置中移除，但在阿里云删除失败: %v", err), http.StatusInternalServerError)
+	// 先删除阿里云上的记录，只解除删除成功的线路的绑定；删除失败的记录仍保留在用户名下，可以重试注销
+	var failedLines []string
+	for _, record := range records {
+		line := record.EffectiveLine()
+		if record.RecordID == "" {
+			log.Printf("警告: 用户 '%s' 尝试删除的域名 %s.%s (线路: %s) 没有关联的 RecordID，仅从本地配置中移除。", username, req.RR, req.DomainName, line)
+		} else if err := aliyun.DeleteDomainRecord(client, record.RecordID); err != nil {
+			log.Printf("错误: 用户 '%s' 在阿里云删除记录 %s (%s.%s, 线路: %s) 失败，保留本地绑定: %v", username, record.RecordID, req.RR, req.DomainName, line, err)
+			failedLines = append(failedLines, line)
+			continue
+		}
+		if _, err := config.UnbindRecordFromUser(username, req.DomainName, req.RR, line); err != nil {
+			log.Printf("严重警告: 已在阿里云删除用户 '%s' 的记录 %s.%s (线路: %s)，但从配置中移除失败: %v", username, req.RR, req.DomainName, line, err)
+			failedLines = append(failedLines, line)
+		}
+	}
+	if len(failedLines) > 0 {
+		writeSecureMessage(w, session, http.StatusInternalServerError, fmt.Sprintf("域名 %s.%s 以下线路的记录注销失败，仍保留在您名下，请稍后重试: %s", req.RR, req.DomainName, strings.Join(failedLines, ", ")))
 		return
 	}
 
 	msg := fmt.Sprintf("域名 %s.%s 已成功注销。", req.RR, req.DomainName)
 	log.Printf("成功: 用户 '%s' %s", username, msg)
-	fmt.Fprintf(w, `{"status":"success", "message":"%s"}`, msg)
+	writeSecureMessage(w, session, http.StatusOK, msg)
 }
@@ -0,0 +1,139 @@
+// ===================================================================================
+// File: ddns-server/handler/recordtoken.go
+// Description: 为摄像头、廉价路由器和 cron 中的 curl 脚本等无法进行 AES-GCM 加密的设备提供简单的令牌更新接口。
+// - HandleRecordToken (/record-token): 用户通过加密请求为自己名下的某条记录生成 (create) 或吊销 (revoke) 专属更新令牌。
+// - HandleTokenUpdate (/u/<token>?ip=...): 持有令牌即可更新且只能更新这一条记录，ip 缺省时使用请求的来源地址；无效令牌计入来源IP的认证失败次数，被锁定时返回 abuse。
+// ===================================================================================
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+type RecordTokenRequest struct {
+	SecretToken string `json:"secret_token"`
+	DomainName  string `json:"domain_name"`
+	RR          string `json:"rr"`
+	Line        string `json:"line,omitempty"`
+	Action      string `json:"action"` // "create" 或 "revoke"
+}
+
+type RecordTokenResponse struct {
+	Status string `json:"status"`
+	Token  string `json:"token,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+func HandleRecordToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持 POST 方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RecordTokenRequest
+	session, err := AuthenticateAndDecrypt(r, &req, config.ScopeFull)
+	if err != nil {
+		writeAuthError(w, session, err)
+		return
+	}
+	username := session.Username
+
+	if req.Action != "create" && req.Action != "revoke" {
+		writeSecureMessage(w, session, http.StatusBadRequest, "action 必须为 create 或 revoke")
+		return
+	}
+	if err := security.ValidateDomain(req.DomainName); err != nil {
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := security.ValidateRR(req.RR); err != nil {
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Line == "" {
+		req.Line = config.DefaultLine
+	}
+	if err := security.ValidateLine(req.Line); err != nil {
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Action == "revoke" {
+		if err := config.SetRecordUpdateToken(username, req.DomainName, req.RR, req.Line, ""); err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("成功: 用户 '%s' 吊销了 %s.%s (线路: %s) 的更新令牌。", username, req.RR, req.DomainName, req.Line)
+		writeSecureJSON(w, session, http.StatusOK, RecordTokenResponse{Status: "success"})
+		return
+	}
+
+	token, err := security.GenerateToken()
+	if err != nil {
+		log.Printf("错误: 生成更新令牌失败: %v", err)
+		writeSecureMessage(w, session, http.StatusInternalServerError, "生成令牌时发生内部错误")
+		return
+	}
+	if err := config.SetRecordUpdateToken(username, req.DomainName, req.RR, req.Line, security.HashToken(token)); err != nil {
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("成功: 用户 '%s' 为 %s.%s (线路: %s) 生成了新的更新令牌。", username, req.RR, req.DomainName, req.Line)
+	writeSecureJSON(w, session, http.StatusOK, RecordTokenResponse{Status: "success", Token: token, Path: "/u/" + token})
+}
+
+func HandleTokenUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "仅支持 GET 和 POST 方法", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	clientIP := security.ClientIP(r)
+	var retryErr retryAfterError
+	if errors.As(security.CheckLockout("", clientIP), &retryErr) {
+		writeAbuse(w, retryErr)
+		return
+	}
+	token := strings.TrimPrefix(r.URL.Path, "/u/")
+	username, record, ok := "", config.DomainRecord{}, false
+	if security.ValidTokenFormat(token) {
+		username, record, ok = config.FindRecordByUpdateToken(security.HashToken(token))
+	}
+	if !ok {
+		log.Printf("令牌更新认证失败: 来源 %s 使用了无效令牌", clientIP)
+		authFailure("", clientIP, nil)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "badauth")
+		return
+	}
+	if errors.As(security.AllowUser(username), &retryErr) {
+		writeAbuse(w, retryErr)
+		return
+	}
+
+	ip := strings.TrimSpace(r.URL.Query().Get("ip"))
+	if ip == "" {
+		ip = clientIP
+	}
+	req := UpdateRequest{DomainName: record.DomainName, RR: record.RR, Line: record.EffectiveLine(), NewIP: ip}
+	changed, _, uerr := performUpdate(username, nil, clientIP, &req)
+	if uerr != nil {
+		log.Printf("令牌更新失败 (用户: %s, 域名: %s.%s): %v", username, record.RR, record.DomainName, uerr)
+		w.WriteHeader(uerr.Status)
+		fmt.Fprintln(w, uerr.Code)
+		return
+	}
+	if changed {
+		fmt.Fprintln(w, "good "+ip)
+	} else {
+		fmt.Fprintln(w, "nochg "+ip)
+	}
+}
@@ -0,0 +1,98 @@
+// ===================================================================================
+// File: ddns-server/handler/status.go
+// Description: 实现 HandleRecordStatus 函数，负责暂停/恢复用户名下的域名记录（维护模式）。暂停后记录在阿里云上停止解析，但仍归属于该用户并占用额度，不会被其他用户注册。
+// ===================================================================================
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/keepsea/goddns/ddns_server/aliyun"
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+type StatusRequest struct {
+	SecretToken string `json:"secret_token"`
+	DomainName  string `json:"domain_name"`
+	RR          string `json:"rr"`
+	Line        string `json:"line,omitempty"`
+	Action      string `json:"action"` // "pause" 或 "resume"
+}
+
+func HandleRecordStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持 POST 方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req StatusRequest
+	session, err := AuthenticateAndDecrypt(r, &req, config.ScopeFull)
+	if err != nil {
+		writeAuthError(w, session, err)
+		return
+	}
+	username := session.Username
+
+	if req.Action != "pause" && req.Action != "resume" {
+		writeSecureMessage(w, session, http.StatusBadRequest, "action 必须为 pause 或 resume")
+		return
+	}
+	if err := security.ValidateDomain(req.DomainName); err != nil {
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := security.ValidateRR(req.RR); err != nil {
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Line != "" {
+		if err := security.ValidateLine(req.Line); err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if err := config.CheckZoneAccess(username, req.DomainName, req.RR); err != nil {
+		log.Printf("拒绝: 用户 '%s' 操作 %s.%s 被域名策略拒绝: %v", username, req.RR, req.DomainName, err)
+		writeSecureMessage(w, session, http.StatusForbidden, err.Error())
+		return
+	}
+
+	records := config.FindUserRecords(username, req.DomainName, req.RR, req.Line)
+	if len(records) == 0 {
+		writeSecureMessage(w, session, http.StatusBadRequest, fmt.Sprintf("您名下未找到域名 %s.%s", req.RR, req.DomainName))
+		return
+	}
+
+	client, err := aliyun.CreateClient()
+	if err != nil {
+		log.Printf("错误: 创建阿里云客户端失败: %v", err)
+		writeSecureMessage(w, session, http.StatusInternalServerError, "服务端配置错误")
+		return
+	}
+	paused := req.Action == "pause"
+	for _, record := range records {
+		if record.RecordID == "" {
+			continue
+		}
+		if err := aliyun.SetRecordStatus(client, record.RecordID, !paused); err != nil {
+			log.Printf("错误: 用户 '%s' 设置记录 %s 状态失败: %v", username, record.RecordID, err)
+			writeSecureMessage(w, session, http.StatusInternalServerError, fmt.Sprintf("设置记录状态失败: %v", err))
+			return
+		}
+	}
+	if err := config.SetRecordPaused(username, req.DomainName, req.RR, req.Line, paused); err != nil {
+		log.Printf("错误: 用户 '%s' 保存记录状态失败: %v", username, err)
+		writeSecureMessage(w, session, http.StatusInternalServerError, "保存记录状态时发生内部错误")
+		return
+	}
+
+	msg := fmt.Sprintf("域名 %s.%s 已恢复解析。", req.RR, req.DomainName)
+	if paused {
+		msg = fmt.Sprintf("域名 %s.%s 已暂停解析，域名仍保留在您名下。", req.RR, req.DomainName)
+	}
+	log.Printf("成功: 用户 '%s' %s", username, msg)
+	writeSecureMessage(w, session, http.StatusOK, msg)
+}
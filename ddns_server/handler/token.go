@@ -0,0 +1,125 @@
+// ===================================================================================
+// File: ddns-server/handler/token.go
+// Description: 实现 HandleManageToken 函数，处理 /manage-token 接口，让用户无需管理员介入即可自助轮换 secret_token。
+// 新令牌由客户端生成，服务端只保存其哈希，轮换语义与加密密钥相同：
+// - rotate: 登记新令牌；宽限期内新旧令牌均有效。
+// - commit: 携带新令牌发送，确认客户端已保存新令牌（任何使用新令牌的请求都会自动提交）。
+// - abort: 放弃轮换，继续使用旧令牌。
+// ===================================================================================
+package handler
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// minSecretTokenLength 是自助设置的 secret_token 的最短长度。
+const minSecretTokenLength = 24
+
+type TokenRequest struct {
+	SecretToken    string `json:"secret_token"`
+	Action         string `json:"action"` // "rotate"、"commit" 或 "abort"
+	NewSecretToken string `json:"new_secret_token,omitempty"`
+}
+
+func HandleManageToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持 POST 方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TokenRequest
+	session, err := AuthenticateAndDecrypt(r, &req, config.ScopeFull)
+	if err != nil {
+		writeAuthError(w, session, err)
+		return
+	}
+
+	switch req.Action {
+	case "rotate":
+		handleRotateToken(w, session, &req)
+	case "commit":
+		handleCommitToken(w, session, &req)
+	case "abort":
+		handleAbortToken(w, session)
+	default:
+		writeSecureMessage(w, session, http.StatusBadRequest, "action 必须为 rotate、commit 或 abort")
+	}
+}
+
+func handleRotateToken(w http.ResponseWriter, session *Session, req *TokenRequest) {
+	username := session.Username
+	if session.rotatedToken {
+		writeSecureMessage(w, session, http.StatusConflict, "上一次令牌轮换刚刚提交，请使用当前令牌重新发起轮换")
+		return
+	}
+	if len(req.NewSecretToken) < minSecretTokenLength || len(req.NewSecretToken) > 128 {
+		writeSecureMessage(w, session, http.StatusBadRequest, "新令牌长度必须在24到128个字符之间")
+		return
+	}
+	user, _ := config.GetUserByKeyLookup(username)
+	if security.VerifySecret(user.SecretTokenHash, req.NewSecretToken) {
+		writeSecureMessage(w, session, http.StatusBadRequest, "新令牌不能与当前令牌相同")
+		return
+	}
+	hash, err := security.HashSecret(req.NewSecretToken)
+	if err != nil {
+		log.Printf("错误: 计算用户 '%s' 的新令牌哈希失败: %v", username, err)
+		writeSecureMessage(w, session, http.StatusInternalServerError, "登记新令牌时发生内部错误")
+		return
+	}
+
+	expiresAt, err := config.BeginTokenRotation(username, hash)
+	if err != nil {
+		log.Printf("错误: 用户 '%s' 开始令牌轮换失败: %v", username, err)
+		writeSecureMessage(w, session, http.StatusInternalServerError, "登记新令牌时发生内部错误")
+		return
+	}
+
+	log.Printf("用户 '%s' 开始了令牌轮换，旧令牌将于 %s 过期。", username, expiresAt.Format(time.RFC3339))
+	writeSecureJSON(w, session, http.StatusOK, RotationResponse{
+		Status:    "success",
+		Message:   "新令牌已登记，请使用新令牌确认",
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	})
+}
+
+func handleCommitToken(w http.ResponseWriter, session *Session, req *TokenRequest) {
+	if session.rotatedToken {
+		writeSecureMessage(w, session, http.StatusOK, "令牌轮换已提交，旧令牌已作废。")
+		return
+	}
+	user, _ := config.GetUserByKeyLookup(session.Username)
+	if user.PendingSecretTokenHash == "" {
+		writeSecureMessage(w, session, http.StatusBadRequest, "当前没有进行中的令牌轮换")
+		return
+	}
+	// 通过设备签名或客户端证书认证的请求不会校验令牌，这里显式确认请求携带的是新令牌。
+	if !security.VerifySecret(user.PendingSecretTokenHash, req.SecretToken) {
+		writeSecureMessage(w, session, http.StatusBadRequest, "commit 请求必须携带新令牌")
+		return
+	}
+	if err := config.CommitTokenRotation(session.Username); err != nil {
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("用户 '%s' 提交了令牌轮换。", session.Username)
+	writeSecureMessage(w, session, http.StatusOK, "令牌轮换已提交，旧令牌已作废。")
+}
+
+func handleAbortToken(w http.ResponseWriter, session *Session) {
+	if session.rotatedToken {
+		writeSecureMessage(w, session, http.StatusConflict, "该请求使用了新令牌，令牌轮换已提交，无法放弃")
+		return
+	}
+	if err := config.AbortTokenRotation(session.Username); err != nil {
+		writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("用户 '%s' 放弃了令牌轮换。", session.Username)
+	writeSecureMessage(w, session, http.StatusOK, "令牌轮换已放弃，继续使用旧令牌。")
+}
@@ -0,0 +1,131 @@
+// ===================================================================================
+// File: ddns-server/handler/totp.go
+// Description: 实现 TOTP 二次验证的登记接口 HandleManageTOTP (/manage-totp) 和供其他处理器调用的 requireTOTP。
+// - enroll: 生成待确认的 TOTP 密钥，返回 otpauth:// 地址供验证器 App 添加。
+// - confirm: 提交验证器显示的验证码，确认后正式启用。
+// - disable: 提交有效验证码后停用 TOTP。
+// 启用 TOTP 后，注销域名和重置加密密钥都必须携带有效的验证码 (totp_code)。错误的验证码计入暴力破解统计，失败过多时锁定（见 security/lockout.go）。
+// ===================================================================================
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// totpIssuer 是显示在验证器 App 中的服务名。
+const totpIssuer = "GoDDNS"
+
+// 需要 TOTP 时返回的错误码，客户端据此提示用户输入验证码。
+const (
+	codeTOTPRequired = "totp_required"
+	codeTOTPInvalid  = "totp_invalid"
+)
+
+type TOTPRequest struct {
+	SecretToken string `json:"secret_token"`
+	Action      string `json:"action"` // "enroll"、"confirm" 或 "disable"
+	TOTPCode    string `json:"totp_code,omitempty"`
+}
+
+type TOTPEnrollResponse struct {
+	Status string `json:"status"`
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// CodedMessageResponse 是带有机器可读错误码的状态信息。
+type CodedMessageResponse struct {
+	Status  string `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func HandleManageTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持 POST 方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TOTPRequest
+	session, err := AuthenticateAndDecrypt(r, &req, config.ScopeFull)
+	if err != nil {
+		writeAuthError(w, session, err)
+		return
+	}
+	username := session.Username
+
+	switch req.Action {
+	case "enroll":
+		secret, err := config.BeginTOTPEnrollment(username)
+		if err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("用户 '%s' 开始登记 TOTP。", username)
+		writeSecureJSON(w, session, http.StatusOK, TOTPEnrollResponse{
+			Status: "success",
+			Secret: secret,
+			URI:    security.TOTPURI(totpIssuer, username, secret),
+		})
+	case "confirm":
+		if err := config.ConfirmTOTPEnrollment(username, req.TOTPCode); err != nil {
+			writeSecureMessage(w, session, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("成功: 用户 '%s' 启用了 TOTP 二次验证。", username)
+		writeSecureMessage(w, session, http.StatusOK, "TOTP 二次验证已启用")
+	case "disable":
+		user, _ := config.GetUserByKeyLookup(username)
+		if !user.TOTPEnabled() {
+			writeSecureMessage(w, session, http.StatusBadRequest, "未启用 TOTP")
+			return
+		}
+		if !requireTOTP(w, session, req.TOTPCode) {
+			return
+		}
+		if err := config.DisableTOTP(username); err != nil {
+			log.Printf("错误: 用户 '%s' 停用 TOTP 失败: %v", username, err)
+			writeSecureMessage(w, session, http.StatusInternalServerError, "停用 TOTP 时发生内部错误")
+			return
+		}
+		log.Printf("用户 '%s' 停用了 TOTP 二次验证。", username)
+		writeSecureMessage(w, session, http.StatusOK, "TOTP 二次验证已停用")
+	default:
+		writeSecureMessage(w, session, http.StatusBadRequest, "action 必须为 enroll、confirm 或 disable")
+	}
+}
+
+// requireTOTP 在用户启用了 TOTP 时校验请求携带的验证码。未携带或校验失败时写回带错误码的加密响应并返回 false。
+func requireTOTP(w http.ResponseWriter, session *Session, code string) bool {
+	user, ok := config.GetUserByKeyLookup(session.Username)
+	if !ok || !user.TOTPEnabled() {
+		return true
+	}
+	if code == "" {
+		writeSecureJSON(w, session, http.StatusUnauthorized, CodedMessageResponse{Status: "error", Code: codeTOTPRequired, Message: "该操作需要 TOTP 验证码"})
+		return false
+	}
+	var retryErr retryAfterError
+	if errors.As(security.CheckTOTPLockout(session.Username), &retryErr) {
+		log.Printf("拒绝: 用户 '%s' 的 TOTP 验证已被锁定: %v", session.Username, retryErr)
+		w.Header().Set("Retry-After", strconv.Itoa(retryErr.RetryAfterSeconds()))
+		writeSecureMessage(w, session, http.StatusTooManyRequests, retryErr.Error())
+		return false
+	}
+	if err := config.ConsumeTOTP(session.Username, code); err != nil {
+		log.Printf("拒绝: 用户 '%s' 的 TOTP 验证失败: %v", session.Username, err)
+		if errors.Is(err, config.ErrInvalidTOTP) && security.RecordTOTPFailure(session.Username, session.clientIP) {
+			log.Printf("警告: TOTP 验证码错误次数过多，已临时锁定 (用户: %s, 来源: %s)", session.Username, session.clientIP)
+		}
+		writeSecureJSON(w, session, http.StatusUnauthorized, CodedMessageResponse{Status: "error", Code: codeTOTPInvalid, Message: err.Error()})
+		return false
+	}
+	security.ClearTOTPFailures(session.Username)
+	return true
+}
@@ -1,10 +1,13 @@
 // ===================================================================================
 // File: ddns-server/handler/update.go
-// Description: 实现 HandleUpdateDNS 函数，专门处理客户端的IP更新请求。它会调用 common.go 的认证函数，然后协调 security 模块进行输入验证，并调用 aliyun 和 config 模块来完成最终的DNS记录创建和更新。
+// Description: 实现 HandleUpdateDNS 函数，专门处理客户端的IP更新请求。它会调用 common.go 的认证函数，然后通过 performUpdate 协调 security 模块进行输入验证，并调用 aliyun 和 config 模块来完成最终的DNS记录创建和更新。
+// performUpdate 同时被 dyndns2 兼容接口复用，保证所有更新入口遵循相同的额度和所有权规则。
+// 每次成功的更新都会按来源地址的国家 / ASN 写入记录历史，来源国家变化时记录告警 (geo.go)。
 // ===================================================================================
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -18,9 +21,19 @@ type UpdateRequest struct {
 	SecretToken string `json:"secret_token"`
 	DomainName  string `json:"domain_name"`
 	RR          string `json:"rr"`
-	NewIP       string `json:"new_ip"`
+	Line        string `json:"line,omitempty"`
+	NewIP       string `json:"new_ip,omitempty"`
 }
 
+// updateError 描述一次IP更新失败的原因，同时携带HTTP状态码和对应的 dyndns2 返回码。
+type updateError struct {
+	Status int
+	Code   string
+	Err    error
+}
+
+func (e *updateError) Error() string { return e.Err.Error() }
+
 func HandleUpdateDNS(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "仅支持 POST 方法", http.StatusMethodNotAllowed)
@@ -28,68 +41,131 @@ func HandleUpdateDNS(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req UpdateRequest
-	username, err := AuthenticateAndDecrypt(r, &req)
+	session, err := AuthenticateAndDecrypt(r, &req, config.ScopeUpdate)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusForbidden)
-		log.Printf("请求处理失败 (用户: %s): %v", username, err)
+		writeAuthError(w, session, err)
 		return
 	}
+	username := session.Username
 
-	if err := security.ValidateDomain(req.DomainName); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !session.allowsRecord(req.DomainName, req.RR, req.Line) {
+		writeSecureMessage(w, session, http.StatusForbidden, fmt.Sprintf("令牌 '%s' 只能更新 %s", session.apiToken.Name, session.apiToken.Record))
 		return
 	}
-	if err := security.ValidateRR(req.RR); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+
+	// 客户端未提供 new_ip 时，使用服务端观察到的来源地址
+	sourceIP := security.ClientIP(r)
+	if req.NewIP == "" {
+		req.NewIP = sourceIP
+	}
+
+	_, msg, uerr := performUpdate(username, session.apiToken, sourceIP, &req)
+	if uerr != nil {
+		writeSecureMessage(w, session, uerr.Status, uerr.Error())
 		return
 	}
+	writeSecureMessage(w, session, http.StatusOK, msg)
+}
+
+// performUpdate 为已认证的用户执行一次IP更新: 输入校验 -> 来源网络限制 -> 地址类别策略 -> 域名策略 -> 令牌范围检查 -> 本地所有权检查 -> 查找/创建记录 -> 绑定 -> 更新记录值。
+// apiToken 为请求所用的 API 令牌（没有时为 nil），sourceIP 为请求的来源地址，两者用于检查来源网络限制 (config/source.go) 和写入记录历史。
+// changed 表示阿里云上的记录值是否发生了变化。
+func performUpdate(username string, apiToken *config.APIToken, sourceIP string, req *UpdateRequest) (changed bool, msg string, uerr *updateError) {
+	if err := security.ValidateDomain(req.DomainName); err != nil {
+		return false, "", &updateError{http.StatusBadRequest, "notfqdn", err}
+	}
+	if err := security.ValidateRR(req.RR); err != nil {
+		return false, "", &updateError{http.StatusBadRequest, "notfqdn", err}
+	}
+	if req.Line == "" {
+		req.Line = config.DefaultLine
+	}
+	if err := security.ValidateLine(req.Line); err != nil {
+		return false, "", &updateError{http.StatusBadRequest, "dnserr", err}
+	}
 	if err := security.ValidateIPv4(req.NewIP); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return false, "", &updateError{http.StatusBadRequest, "dnserr", err}
+	}
+	geo := security.LookupGeo(sourceIP)
+	if err := config.CheckUpdateSource(username, apiToken, sourceIP, req.NewIP, geo); err != nil {
+		log.Printf("拒绝 (来源网络限制): 用户 '%s' 更新 %s.%s，来源 %s: %v", username, req.RR, req.DomainName, sourceIP, err)
+		return false, "", &updateError{http.StatusForbidden, "abuse", fmt.Errorf("来源网络限制: %w", err)}
+	}
+	if err := config.CheckAddressClass(req.DomainName, req.NewIP); err != nil {
+		log.Printf("拒绝: 用户 '%s' 更新 %s.%s 被地址类别策略拒绝: %v", username, req.RR, req.DomainName, err)
+		return false, "", &updateError{http.StatusBadRequest, "dnserr", err}
+	}
+	if err := config.CheckZoneAccess(username, req.DomainName, req.RR); err != nil {
+		log.Printf("拒绝: 用户 '%s' 操作 %s.%s 被域名策略拒绝: %v", username, req.RR, req.DomainName, err)
+		return false, "", &updateError{http.StatusForbidden, "nohost", err}
+	}
+	// update 范围的 API 令牌只能更新已经绑定到该用户名下的记录，不能借更新之名注册新记录、占用用户的额度
+	knownRecord, bound := config.GetUserRecord(username, req.DomainName, req.RR, req.Line)
+	if !bound && apiToken != nil && apiToken.Scope == config.ScopeUpdate {
+		err := fmt.Errorf("令牌 '%s' 只能更新已注册的记录，%s.%s 尚未注册", apiToken.Name, req.RR, req.DomainName)
+		log.Printf("拒绝: 用户 '%s' 的 update 令牌试图创建新记录: %v", username, err)
+		return false, "", &updateError{http.StatusForbidden, "nohost", err}
+	}
+	// 本地所有权和额度检查必须先于任何阿里云操作，失败时不能改动阿里云上的记录
+	if err := config.CheckRecordBindable(username, req.DomainName, req.RR); err != nil {
+		log.Printf("拒绝: 用户 '%s' 无法绑定 %s.%s: %v", username, req.RR, req.DomainName, err)
+		return false, "", &updateError{http.StatusConflict, "nohost", err}
 	}
 
 	client, err := aliyun.CreateClient()
 	if err != nil {
 		log.Printf("错误: 创建阿里云客户端失败: %v", err)
-		http.Error(w, "服务端配置错误", http.StatusInternalServerError)
-		return
+		return false, "", &updateError{http.StatusInternalServerError, "911", errors.New("服务端配置错误")}
 	}
 
-	recordID, currentIP, err := aliyun.GetOrCreateDomainRecord(client, req.DomainName, req.RR, req.NewIP)
+	recordID, currentIP, created, err := aliyun.GetOrCreateDomainRecord(client, req.DomainName, req.RR, req.Line, req.NewIP, username, knownRecord.RecordID)
+	if errors.Is(err, aliyun.ErrUnmanagedRecord) || errors.Is(err, aliyun.ErrForeignRecord) {
+		log.Printf("拒绝: 用户 '%s' 试图接管不属于自己的记录 %s.%s: %v", username, req.RR, req.DomainName, err)
+		return false, "", &updateError{http.StatusConflict, "nohost", err}
+	}
 	if err != nil {
 		log.Printf("错误: 用户 '%s' 获取/创建域名记录失败: %v", username, err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return false, "", &updateError{http.StatusInternalServerError, "dnserr", err}
 	}
 
-	if err := config.BindRecordToUser(username, req.DomainName, req.RR, recordID); err != nil {
+	if err := config.BindRecordToUser(username, req.DomainName, req.RR, req.Line, recordID); err != nil {
 		log.Printf("错误: 用户 '%s' 的域名绑定失败: %v", username, err)
-		if currentIP != req.NewIP { // Only rollback if we created a new record
+		if created { // Only rollback if we created a new record
 			log.Printf("回滚操作：正在删除刚刚为用户 '%s' 创建的记录 %s", username, recordID)
 			if delErr := aliyun.DeleteDomainRecord(client, recordID); delErr != nil {
 				log.Printf("严重警告：回滚删除操作失败！RecordID: %s, 错误: %v", recordID, delErr)
 			}
 		}
-		http.Error(w, err.Error(), http.StatusConflict)
-		return
+		return false, "", &updateError{http.StatusConflict, "nohost", err}
+	}
+
+	pausedNote := ""
+	if knownRecord.Paused {
+		pausedNote = " (该记录处于暂停状态，恢复后生效)"
+	}
+
+	if created {
+		msg = fmt.Sprintf("域名 %s.%s (线路: %s) 已创建并解析到 %s%s", req.RR, req.DomainName, req.Line, req.NewIP, pausedNote)
+		log.Printf("成功: 用户 '%s' %s", username, msg)
+		recordUpdateEvent(username, apiToken, sourceIP, geo, req)
+		return true, msg, nil
 	}
 
 	if currentIP == req.NewIP {
-		msg := fmt.Sprintf("IP 地址未变化 (%s)，无需更新。", req.NewIP)
+		msg = fmt.Sprintf("IP 地址未变化 (%s)，无需更新。%s", req.NewIP, pausedNote)
 		log.Printf("用户 '%s': %s", username, msg)
-		fmt.Fprintf(w, `{"status": "success", "message": "%s"}`, msg)
-		return
+		recordUpdateEvent(username, apiToken, sourceIP, geo, req)
+		return false, msg, nil
 	}
 
-	err = aliyun.UpdateRecordValue(client, recordID, req.RR, req.NewIP)
+	err = aliyun.UpdateRecordValue(client, recordID, req.RR, req.Line, req.NewIP)
 	if err != nil {
 		log.Printf("错误: 用户 '%s' 更新域名记录失败: %v", username, err)
-		http.Error(w, fmt.Sprintf("更新域名记录失败: %v", err), http.StatusInternalServerError)
-		return
+		return false, "", &updateError{http.StatusInternalServerError, "dnserr", fmt.Errorf("更新域名记录失败: %v", err)}
 	}
 
-	msg := fmt.Sprintf("域名 %s.%s 已更新为 %s", req.RR, req.DomainName, req.NewIP)
+	msg = fmt.Sprintf("域名 %s.%s (线路: %s) 已更新为 %s%s", req.RR, req.DomainName, req.Line, req.NewIP, pausedNote)
 	log.Printf("成功: 用户 '%s' %s", username, msg)
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"status": "success", "message": "%s"}`, msg)
+	recordUpdateEvent(username, apiToken, sourceIP, geo, req)
+	return true, msg, nil
 }
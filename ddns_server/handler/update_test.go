@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+// setTestZones 将 example.com 设为唯一托管域名、只允许公网地址并使用给定的保留名单，测试结束后恢复。
+func setTestZones(t *testing.T, reserved ...string) {
+	t.Helper()
+	oldZones, oldReserved, oldClasses := config.ManagedZones, config.ReservedRRs, config.AllowedIPClasses
+	config.ManagedZones, config.ReservedRRs = []string{"example.com"}, reserved
+	config.AllowedIPClasses = []string{security.IPClassPublic}
+	t.Cleanup(func() {
+		config.ManagedZones, config.ReservedRRs, config.AllowedIPClasses = oldZones, oldReserved, oldClasses
+	})
+}
+
+func TestPerformUpdateSourcePolicy(t *testing.T) {
+	loadTestUsers(t, `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`","source_cidrs":["198.51.100.0/24"]}]}`)
+
+	_, _, uerr := performUpdate("alice", nil, "192.0.2.1", &UpdateRequest{DomainName: "example.com", RR: "home", NewIP: "203.0.113.5"})
+	if uerr == nil || uerr.Status != http.StatusForbidden || uerr.Code != "abuse" || !strings.HasPrefix(uerr.Error(), "来源网络限制") {
+		t.Fatalf("performUpdate() = %+v，来源网络限制应返回 403 abuse", uerr)
+	}
+}
+
+// 所有权、额度和保留名称检查都必须在访问阿里云之前拒绝请求。
+func TestPerformUpdateOwnershipAndQuota(t *testing.T) {
+	loadTestUsers(t, `{"users":[
+		{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`","domain_limit":1,
+		 "records":[{"domain_name":"example.com","rr":"home","record_id":"1"}]},
+		{"username":"bob","secret_token":"tok","encryption_key":"`+testKey+`","domain_limit":2,
+		 "records":[{"domain_name":"example.com","rr":"taken","record_id":"2"}]}]}`)
+	setTestZones(t, "www")
+
+	tests := []struct {
+		name, username, domain, rr string
+		status                     int
+	}{
+		{"他人的记录", "bob", "example.com", "home", http.StatusConflict},
+		{"超出额度", "alice", "example.com", "new", http.StatusConflict},
+		{"非托管域名", "alice", "other.com", "home", http.StatusForbidden},
+		{"保留名称", "bob", "example.com", "www", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		_, _, uerr := performUpdate(tt.username, nil, "192.0.2.1", &UpdateRequest{DomainName: tt.domain, RR: tt.rr, NewIP: "8.8.8.8"})
+		if uerr == nil || uerr.Status != tt.status || uerr.Code != "nohost" {
+			t.Errorf("%s: performUpdate() = %+v, want %d nohost", tt.name, uerr, tt.status)
+		}
+	}
+}
+
+func TestPerformUpdateScopeTokenCannotRegister(t *testing.T) {
+	loadTestUsers(t, `{"users":[{"username":"alice","secret_token":"tok","encryption_key":"`+testKey+`","domain_limit":2}]}`)
+	setTestZones(t)
+
+	token := &config.APIToken{Name: "router", Scope: config.ScopeUpdate}
+	_, _, uerr := performUpdate("alice", token, "192.0.2.1", &UpdateRequest{DomainName: "example.com", RR: "home", NewIP: "8.8.8.8"})
+	if uerr == nil || uerr.Status != http.StatusForbidden || uerr.Code != "nohost" {
+		t.Fatalf("performUpdate() = %+v，update 令牌不能注册新记录", uerr)
+	}
+}
@@ -0,0 +1,49 @@
+// ===================================================================================
+// File: ddns-server/handler/whoami.go
+// Description: 实现 HandleWhoAmI 函数，向已认证的用户返回服务端观察到的请求来源地址。客户端可以用它代替 api.ipify.org 等第三方服务检测公网IP。
+// ===================================================================================
+package handler
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/keepsea/goddns/ddns_server/config"
+	"github.com/keepsea/goddns/ddns_server/security"
+)
+
+type WhoAmIRequest struct {
+	SecretToken string `json:"secret_token"`
+}
+
+type WhoAmIResponse struct {
+	Status string `json:"status"`
+	IP     string `json:"ip"`
+	Family string `json:"family"` // "ipv4" 或 "ipv6"
+}
+
+func HandleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持 POST 方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req WhoAmIRequest
+	session, err := AuthenticateAndDecrypt(r, &req, config.ScopeAny)
+	if err != nil {
+		writeAuthError(w, session, err)
+		return
+	}
+
+	ip := security.ClientIP(r)
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		writeSecureMessage(w, session, http.StatusInternalServerError, "无法确定请求的来源地址")
+		return
+	}
+	resp := WhoAmIResponse{Status: "success", IP: ip, Family: "ipv6"}
+	if parsed.To4() != nil {
+		resp.Family = "ipv4"
+	}
+	writeSecureJSON(w, session, http.StatusOK, resp)
+}
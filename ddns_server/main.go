@@ -2,7 +2,7 @@
 // File: ddns-server/main.go
 // Description: 项目主入口，负责初始化和启动服务。
 // - 调用 config 模块加载所有配置。
-// - 初始化 HTTP 路由，将不同的 API 路径（如 /update-dns, /manage-records）绑定到 handler 模块中对应的处理函数。
+// - 初始化 HTTP 路由，将不同的 API 路径（如 /update-dns, /manage-records, /record-status）绑定到 handler 模块中对应的处理函数。
 // - 应用 security 模块中的中间件（如速率限制）。
 // - 启动并监听 Web 服务。
 
@@ -14,8 +14,12 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/keepsea/goddns/ddns_server/config"
@@ -24,25 +28,77 @@ import (
 )
 
 func main() {
+	importFlag := flag.String("import-record", "", "管理员操作: 将阿里云上已存在的记录导入并绑定给用户。用法: -import-record <username>:<rr.domain.com>")
+	genMasterKeyFlag := flag.Bool("gen-master-key", false, "管理员操作: 生成一个新的主密钥并输出，用于封装 users.json 中的加密密钥。")
+	migrateFlag := flag.Bool("migrate-users", false, "管理员操作: 将 users.json 中的明文凭据迁移为哈希/封装形式后退出。")
+	importLineFlag := flag.String("import-line", config.DefaultLine, "配合 -import-record 使用，指定要导入记录的解析线路。")
+	flag.Parse()
+
+	if *genMasterKeyFlag {
+		key, err := security.GenerateMasterKey()
+		if err != nil {
+			log.Fatalf("错误: 生成主密钥失败: %v", err)
+		}
+		fmt.Println(key)
+		return
+	}
+
 	log.Println("GODDNS 服务端 (V2.1.0) 启动中...")
 
 	// 启动时加载所有配置
 	if err := config.LoadServerConfig(); err != nil {
 		log.Fatalf("错误: 启动时加载服务端配置失败: %v", err)
 	}
+	if err := security.SetTrustedProxies(config.TrustedProxies, config.ClientIPSource); err != nil {
+		log.Fatalf("错误: 启动时加载受信任代理配置失败: %v", err)
+	}
+	security.SetMaxClockSkew(config.MaxClockSkew)
+	security.SetLockoutPolicy(config.LockoutThreshold, config.LockoutBase, config.LockoutMax)
+	security.SetRateLimits(config.RateLimitDefault, config.RateLimitRoutes, config.RateLimitUser, config.RateLimitUsers, config.RateLimitIdle, config.RateLimitMaxEntries)
+	security.SetRateLimitResponder("/nic/update", handler.WriteRateLimitAbuse)
+	security.SetRateLimitResponder("/u/", handler.WriteRateLimitAbuse)
+	if err := security.LoadGeoIP(config.GeoIPCountryDB, config.GeoIPASNDB); err != nil {
+		log.Fatalf("错误: 启动时加载 GeoIP 数据库失败: %v", err)
+	}
+	masterKey, err := config.LoadMasterKey()
+	if err != nil {
+		log.Fatalf("错误: 启动时加载主密钥失败: %v", err)
+	}
+	security.SetMasterKey(masterKey)
 	if err := config.LoadUsers(); err != nil {
 		log.Fatalf("错误: 启动时加载用户配置失败: %v", err)
 	}
 
+	if *migrateFlag {
+		log.Println("用户配置迁移完成。")
+		return
+	}
+	if *importFlag != "" {
+		if err := runImportRecord(*importFlag, *importLineFlag); err != nil {
+			log.Fatalf("错误: 导入记录失败: %v", err)
+		}
+		return
+	}
+
 	// 创建一个新的 ServeMux 来精细控制路由
 	mux := http.NewServeMux()
 	mux.HandleFunc("/update-dns", handler.HandleUpdateDNS)
 	mux.HandleFunc("/manage-records", handler.HandleManageRecords)
 	mux.HandleFunc("/manage-key", handler.HandleManageKey)
+	mux.HandleFunc("/manage-token", handler.HandleManageToken)
+	mux.HandleFunc("/manage-api-tokens", handler.HandleManageAPITokens)
+	mux.HandleFunc("/manage-totp", handler.HandleManageTOTP)
+	mux.HandleFunc("/record-status", handler.HandleRecordStatus)
+	mux.HandleFunc("/nic/update", handler.HandleDynDNSUpdate)
+	mux.HandleFunc("/record-token", handler.HandleRecordToken)
+	mux.HandleFunc("/u/", handler.HandleTokenUpdate)
+	mux.HandleFunc("/whoami", handler.HandleWhoAmI)
+	mux.HandleFunc("/manage-devices", handler.HandleManageDevices)
+	mux.HandleFunc("/admin/lockouts", handler.HandleAdminLockouts)
 
 	// 应用我们的安全中间件
 	// 1. 限制请求体大小为1MB
-	// 2. 对每个IP进行速率限制
+	// 2. 按来源IP和路由进行令牌桶限速（通过认证后再按用户限速，见 handler/common.go）
 	handlerWithMiddleware := security.LimitRequestSize(mux, 1024*1024)
 	handlerWithMiddleware = security.RateLimit(handlerWithMiddleware)
 
@@ -53,8 +109,57 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 	}
 
-	log.Printf("将在端口 %s 上监听请求", config.ServerPort)
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("错误: 启动 HTTP 服务器失败: %v", err)
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatalf("错误: 监听端口 %s 失败: %v", config.ServerPort, err)
+	}
+	if config.ClientIPSource == security.ClientIPFromProxyProtocol {
+		// 只有来自受信任代理的连接需要并会解析 PROXY 头
+		listener = security.ProxyProtocolListener(listener)
+		log.Printf("已启用 PROXY 协议，受信任代理: %s", strings.Join(config.TrustedProxies, ", "))
+	}
+
+	if config.TLSCertFile == "" {
+		log.Printf("将在端口 %s 上监听 HTTP 请求", config.ServerPort)
+		if err := server.Serve(listener); err != nil {
+			log.Fatalf("错误: 启动 HTTP 服务器失败: %v", err)
+		}
+		return
+	}
+
+	reloader, err := security.NewCertReloader(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		log.Fatalf("错误: 启动时加载 TLS 证书失败: %v", err)
+	}
+	reloader.Watch(config.TLSReload)
+	server.TLSConfig = security.NewTLSConfig(reloader, config.TLSMinVersion)
+	if config.ClientCAFile != "" {
+		verifier, err := security.NewClientCertVerifier(config.ClientCAFile, config.ClientCRLFile)
+		if err != nil {
+			log.Fatalf("错误: 启动时加载客户端证书配置失败: %v", err)
+		}
+		verifier.Watch(config.TLSReload)
+		verifier.Apply(server.TLSConfig)
+		log.Printf("已启用客户端证书认证 (mTLS)，CA: %s", config.ClientCAFile)
+	}
+
+	if config.RedirectPort != "" {
+		redirectServer := &http.Server{
+			Addr:         ":" + config.RedirectPort,
+			Handler:      security.RedirectToHTTPS(config.ServerPort),
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 5 * time.Second,
+		}
+		go func() {
+			log.Printf("将在端口 %s 上监听 HTTP 请求并跳转到 HTTPS", config.RedirectPort)
+			if err := redirectServer.ListenAndServe(); err != nil {
+				log.Fatalf("错误: 启动 HTTP 跳转服务失败: %v", err)
+			}
+		}()
+	}
+
+	log.Printf("将在端口 %s 上监听 HTTPS 请求 (最低 TLS %s)", config.ServerPort, config.TLSMinVersion)
+	if err := server.ServeTLS(listener, "", ""); err != nil {
+		log.Fatalf("错误: 启动 HTTPS 服务器失败: %v", err)
 	}
 }
@@ -1,6 +1,6 @@
 // ===================================================================================
 // File: ddns-server/security/crypto.go
-// Description: 提供了 Encrypt 和 Decrypt 两个核心函数，基于AES-GCM算法实现应用层的对称加密，确保了通信内容的机密性。
+// Description: 提供了 Encrypt 和 Decrypt 两个核心函数，基于AES-GCM算法实现应用层的对称加密，确保了通信内容的机密性。additionalData 作为附加认证数据参与校验但不加密，其格式见 envelope.go。
 // ===================================================================================
 package security
 
@@ -13,7 +13,7 @@ import (
 	"io"
 )
 
-func Encrypt(key, plaintext []byte) (string, error) {
+func Encrypt(key, plaintext, additionalData []byte) (string, error) {
 	if len(key) != 32 {
 		return "", fmt.Errorf("密钥长度必须为16、24或32字节")
 	}
@@ -29,10 +29,10 @@ func Encrypt(key, plaintext []byte) (string, error) {
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
 	}
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, additionalData)
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
-func Decrypt(key []byte, ciphertext string) ([]byte, error) {
+func Decrypt(key []byte, ciphertext string, additionalData []byte) ([]byte, error) {
 	if len(key) != 32 {
 		return nil, fmt.Errorf("密钥长度必须为16、24或32字节")
 	}
@@ -52,7 +52,7 @@ func Decrypt(key []byte, ciphertext string) ([]byte, error) {
 		return nil, fmt.Errorf("密文过短")
 	}
 	nonce, encryptedMessage := data[:gcm.NonceSize()], data[gcm.NonceSize():]
-	plaintext, err := gcm.Open(nil, nonce, encryptedMessage, nil)
+	plaintext, err := gcm.Open(nil, nonce, encryptedMessage, additionalData)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,38 @@
+// ===================================================================================
+// File: ddns-server/security/envelope.go
+// Description: 定义客户端与服务端之间加密信封的格式。本文件与 ddns-client/security/envelope.go 保持一致，修改时必须同步；两个模块的 envelope_test.go 使用同一组测试向量，任一份实现改动后测试都会失败。
+// - 信封带有版本号 (v)，服务端只接受当前版本。
+// - 用户名、请求方向、HTTP 方法和路径作为 AES-GCM 的附加认证数据 (AAD) 参与认证，因此为某个接口捕获的密文无法被用于另一个接口或另一种方法，请求密文也无法被当作响应使用。
+// - 已登记设备的请求带有设备名 (device) 和 Ed25519 签名 (sig)，签名覆盖附加认证数据和密文，见 SigningInput。
+// ===================================================================================
+package security
+
+import "strings"
+
+// EnvelopeVersion 是当前加密信封格式的版本号。
+const EnvelopeVersion = 2
+
+const (
+	DirectionRequest  = "req"
+	DirectionResponse = "resp"
+)
+
+// Envelope 是加密请求和加密响应在网络上传输的外层结构，Data 为 base64 编码的 nonce+密文。
+type Envelope struct {
+	Version  int    `json:"v"`
+	Username string `json:"username,omitempty"`
+	Device   string `json:"device,omitempty"`
+	Data     string `json:"data"`
+	// Signature 是设备私钥对 SigningInput 的 Ed25519 签名 (base64)，仅在 Device 非空时使用。
+	Signature string `json:"sig,omitempty"`
+}
+
+// AssociatedData 构造信封的附加认证数据。method 统一转为大写，path 不包含查询参数。
+func AssociatedData(direction, username, method, path string) []byte {
+	return []byte(strings.Join([]string{"goddns/v2", direction, username, strings.ToUpper(method), path}, "\n"))
+}
+
+// SigningInput 构造设备签名覆盖的内容：附加认证数据加上 base64 形式的密文。
+func SigningInput(associatedData []byte, data string) []byte {
+	return []byte(string(associatedData) + "\n" + data)
+}
@@ -0,0 +1,78 @@
+package security
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+)
+
+// 以下测试向量同时存在于 ddns-server/security/envelope_test.go 和 ddns-client/security/envelope_test.go，两边必须完全一致。
+// 修改信封格式、附加认证数据或签名内容时，两个模块的测试都会失败，需要同时更新两份实现和这组向量。
+const (
+	vectorKey       = "0123456789abcdef0123456789abcdef"
+	vectorUsername  = "alice"
+	vectorMethod    = "post"
+	vectorPath      = "/update-dns"
+	vectorPlaintext = `{"domain_name":"example.com","rr":"home"}`
+	vectorAAD       = "goddns/v2\nreq\nalice\nPOST\n/update-dns"
+	vectorData      = "AAECAwQFBgcICQoLVsffE7R5u8L3shDTFO3rJoNwYupM0BGlQ7PWlpQH3vafkRR2JthyMuzmMcKGjlw0ygUuIq7bcesL"
+	vectorPublicKey = "A6EHv/POEL4dcN0Y50vAmWfk1jCbpQ1fHdyGZBJVMbg="
+	vectorSignature = "BqHUSpnWN22851erEgKPhambEnwJxpYembDKuvO+0ZyZ3s5Cynz6H96MX0Pa/XtHZWTuJpL9r1bU2dhKLh0fBg=="
+	vectorEnvelope  = `{"v":2,"username":"alice","device":"router","data":"` + vectorData + `","sig":"` + vectorSignature + `"}`
+)
+
+// vectorDeviceKey 返回种子为 0x00..0x1f 的设备私钥。
+func vectorDeviceKey() ed25519.PrivateKey {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+func TestEnvelopeVector(t *testing.T) {
+	if EnvelopeVersion != 2 {
+		t.Fatalf("EnvelopeVersion = %d, 测试向量对应版本 2", EnvelopeVersion)
+	}
+	aad := AssociatedData(DirectionRequest, vectorUsername, vectorMethod, vectorPath)
+	if string(aad) != vectorAAD {
+		t.Fatalf("AssociatedData = %q, want %q", aad, vectorAAD)
+	}
+	plaintext, err := Decrypt([]byte(vectorKey), vectorData, aad)
+	if err != nil || string(plaintext) != vectorPlaintext {
+		t.Fatalf("Decrypt = %q, %v; want %q", plaintext, err, vectorPlaintext)
+	}
+	if _, err := Decrypt([]byte(vectorKey), vectorData, AssociatedData(DirectionResponse, vectorUsername, vectorMethod, vectorPath)); err == nil {
+		t.Fatal("请求密文被当作响应解密成功")
+	}
+
+	ciphertext, err := Encrypt([]byte(vectorKey), []byte(vectorPlaintext), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := Decrypt([]byte(vectorKey), ciphertext, aad); err != nil || string(plaintext) != vectorPlaintext {
+		t.Fatalf("往返解密 = %q, %v", plaintext, err)
+	}
+
+	encoded, err := json.Marshal(Envelope{Version: EnvelopeVersion, Username: vectorUsername, Device: "router", Data: vectorData, Signature: vectorSignature})
+	if err != nil || string(encoded) != vectorEnvelope {
+		t.Fatalf("Envelope JSON = %s, %v; want %s", encoded, err, vectorEnvelope)
+	}
+}
+
+func TestDeviceSignatureVector(t *testing.T) {
+	publicKey, err := ParseDevicePublicKey(vectorPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !publicKey.Equal(vectorDeviceKey().Public()) {
+		t.Fatal("设备公钥与测试向量的私钥不匹配")
+	}
+	input := SigningInput([]byte(vectorAAD), vectorData)
+	if !VerifyDeviceSignature(publicKey, input, vectorSignature) {
+		t.Fatal("VerifyDeviceSignature 拒绝了测试向量中的签名")
+	}
+	if VerifyDeviceSignature(publicKey, SigningInput([]byte(vectorAAD), vectorData+"A"), vectorSignature) {
+		t.Fatal("VerifyDeviceSignature 接受了被篡改的密文")
+	}
+}
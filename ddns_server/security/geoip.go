@@ -0,0 +1,98 @@
+// ===================================================================================
+// File: ddns-server/security/geoip.go
+// Description: 基于本地 MaxMind DB 文件的离线 GeoIP / ASN 查询，用于标注每次更新的来源国家和自治系统，并支持按国家 / ASN 限制更新来源。
+// - 国家数据库 (GeoLite2-Country / GeoLite2-City 等) 读取 country.iso_code，没有时使用 registered_country.iso_code。
+// - ASN 数据库 (GeoLite2-ASN 等) 读取 autonomous_system_number 和 autonomous_system_organization。
+// - 两个数据库都是可选的；未配置或查不到时对应字段为空。数据库文件更新后需要重启服务端。
+// ===================================================================================
+package security
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// GeoInfo 是一个地址的国家和自治系统信息，查不到的字段为空。
+type GeoInfo struct {
+	Country string `json:"country,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	ASOrg   string `json:"as_org,omitempty"`
+}
+
+var (
+	countryDB  *MMDB
+	asnDB      *MMDB
+	geoIPMutex = &sync.RWMutex{}
+)
+
+// LoadGeoIP 加载国家和 ASN 数据库，路径为空时不加载对应的数据库。
+func LoadGeoIP(countryPath, asnPath string) error {
+	var country, asn *MMDB
+	var err error
+	if countryPath != "" {
+		if country, err = OpenMMDB(countryPath); err != nil {
+			return fmt.Errorf("加载国家数据库失败: %w", err)
+		}
+	}
+	if asnPath != "" {
+		if asn, err = OpenMMDB(asnPath); err != nil {
+			return fmt.Errorf("加载 ASN 数据库失败: %w", err)
+		}
+	}
+	geoIPMutex.Lock()
+	countryDB, asnDB = country, asn
+	geoIPMutex.Unlock()
+	return nil
+}
+
+// GeoIPAvailable 返回国家数据库和 ASN 数据库是否已加载。
+func GeoIPAvailable() (country, asn bool) {
+	geoIPMutex.RLock()
+	defer geoIPMutex.RUnlock()
+	return countryDB != nil, asnDB != nil
+}
+
+// LookupGeo 查询地址的国家和自治系统信息。
+func LookupGeo(ip string) GeoInfo {
+	var info GeoInfo
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return info
+	}
+	geoIPMutex.RLock()
+	defer geoIPMutex.RUnlock()
+
+	if countryDB != nil {
+		if record, found, err := countryDB.Lookup(parsed); err == nil && found {
+			info.Country = mmdbString(record, "country", "iso_code")
+			if info.Country == "" {
+				info.Country = mmdbString(record, "registered_country", "iso_code")
+			}
+		}
+	}
+	if asnDB != nil {
+		if record, found, err := asnDB.Lookup(parsed); err == nil && found {
+			if m, ok := record.(map[string]interface{}); ok {
+				if number, ok := m["autonomous_system_number"].(uint64); ok {
+					info.ASN = uint(number)
+				}
+				info.ASOrg, _ = m["autonomous_system_organization"].(string)
+			}
+		}
+	}
+	return info
+}
+
+// mmdbString 按路径取出嵌套 map 中的字符串值。
+func mmdbString(record interface{}, path ...string) string {
+	for _, key := range path {
+		m, ok := record.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		record = m[key]
+	}
+	s, _ := record.(string)
+	return s
+}
@@ -0,0 +1,82 @@
+// ===================================================================================
+// File: ddns-server/security/ipclass.go
+// Description: 将 IPv4 地址划分为 public / private / cgnat / reserved 四类，供服务端按策略决定哪些地址可以写入解析记录。
+// - private: RFC 1918 私有地址 (10/8, 172.16/12, 192.168/16)。
+// - cgnat: 运营商级 NAT 共享地址 (100.64/10, RFC 6598)。
+// - reserved: 本网、环回、链路本地、文档/测试网段、基准测试网段、组播、保留和广播地址等不可在公网路由的地址。
+// - public: 以上之外的地址。
+// ===================================================================================
+package security
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// 地址类别。
+const (
+	IPClassPublic   = "public"
+	IPClassPrivate  = "private"
+	IPClassCGNAT    = "cgnat"
+	IPClassReserved = "reserved"
+)
+
+var (
+	privateNets  = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16")
+	cgnatNets    = mustParseCIDRs("100.64.0.0/10")
+	reservedNets = mustParseCIDRs(
+		"0.0.0.0/8",          // 本网
+		"127.0.0.0/8",        // 环回
+		"169.254.0.0/16",     // 链路本地
+		"192.0.0.0/24",       // IETF 协议分配
+		"192.0.2.0/24",       // 文档 (TEST-NET-1)
+		"192.88.99.0/24",     // 6to4 中继 (已废弃)
+		"198.18.0.0/15",      // 基准测试
+		"198.51.100.0/24",    // 文档 (TEST-NET-2)
+		"203.0.113.0/24",     // 文档 (TEST-NET-3)
+		"224.0.0.0/4",        // 组播
+		"240.0.0.0/4",        // 保留
+		"255.255.255.255/32", // 广播
+	)
+)
+
+func mustParseCIDRs(entries ...string) []*net.IPNet {
+	nets, err := ParseCIDRs(entries)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+// ClassifyIPv4 返回地址的类别。无法解析的地址视为 reserved。
+func ClassifyIPv4(ip string) string {
+	parsed := net.ParseIP(ip).To4()
+	switch {
+	case parsed == nil || ContainsIP(reservedNets, parsed):
+		return IPClassReserved
+	case ContainsIP(privateNets, parsed):
+		return IPClassPrivate
+	case ContainsIP(cgnatNets, parsed):
+		return IPClassCGNAT
+	default:
+		return IPClassPublic
+	}
+}
+
+// ValidateIPClasses 检查配置中的地址类别名称，返回统一为小写的列表。
+func ValidateIPClasses(classes []string) ([]string, error) {
+	var result []string
+	for _, class := range classes {
+		class = strings.ToLower(strings.TrimSpace(class))
+		switch class {
+		case "":
+			continue
+		case IPClassPublic, IPClassPrivate, IPClassCGNAT, IPClassReserved:
+			result = append(result, class)
+		default:
+			return nil, fmt.Errorf("未知的地址类别 '%s'，可选值为 public, private, cgnat, reserved", class)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,39 @@
+package security
+
+import "testing"
+
+func TestClassifyIPv4(t *testing.T) {
+	tests := []struct{ ip, want string }{
+		{"8.8.8.8", IPClassPublic},
+		{"100.63.255.255", IPClassPublic},
+		{"10.1.2.3", IPClassPrivate},
+		{"172.31.255.255", IPClassPrivate},
+		{"172.32.0.1", IPClassPublic},
+		{"192.168.1.1", IPClassPrivate},
+		{"100.64.0.1", IPClassCGNAT},
+		{"100.127.255.255", IPClassCGNAT},
+		{"127.0.0.1", IPClassReserved},
+		{"169.254.1.1", IPClassReserved},
+		{"198.51.100.7", IPClassReserved},
+		{"224.0.0.1", IPClassReserved},
+		{"255.255.255.255", IPClassReserved},
+		{"::ffff:10.1.2.3", IPClassPrivate},
+		{"2001:db8::1", IPClassReserved},
+		{"bogus", IPClassReserved},
+	}
+	for _, tt := range tests {
+		if got := ClassifyIPv4(tt.ip); got != tt.want {
+			t.Errorf("ClassifyIPv4(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestValidateIPClasses(t *testing.T) {
+	got, err := ValidateIPClasses([]string{" Public", "", "CGNAT "})
+	if err != nil || len(got) != 2 || got[0] != IPClassPublic || got[1] != IPClassCGNAT {
+		t.Fatalf("ValidateIPClasses = %v, %v", got, err)
+	}
+	if _, err := ValidateIPClasses([]string{"public", "intranet"}); err == nil {
+		t.Fatal("未知的地址类别应返回错误")
+	}
+}
@@ -0,0 +1,257 @@
+// ===================================================================================
+// File: ddns-server/security/lockout.go
+// Description: 提供暴力破解防护。分别按 (用户名, 来源IP) 组合、用户名和来源IP统计认证失败次数：
+// - 连续失败达到阈值后临时锁定，锁定时长从基础时长开始，之后每多失败一次翻倍，直到上限；
+// - 锁定期间的请求直接拒绝，不再校验凭据，也不再累计失败次数；
+// - (用户名, 来源IP) 的锁定只作用于失败发生的来源IP，他人在别处反复输错密码不会很快把合法用户或路由器锁在门外；
+// - 用户名的计数 (kind 为 "account") 汇总所有来源IP，阈值是普通阈值的 accountThresholdFactor 倍，用于阻止分散在大量IP上的暴力破解，同时让单个攻击者难以锁住受害者；
+// - 认证成功只清除该 (用户名, 来源IP) 的记录。来源IP和用户名的计数不因成功登录而清零，攻击者无法用自己的账号重置针对其他用户的失败次数；
+// - TOTP 验证码错误除计入上述记录外，还按用户名单独累计 (kind 为 "totp")，只有验证码正确才会清除，因此持有密码的攻击者无法靠每次重新认证来清零并穷举验证码；
+// - 超过上限时长没有新的失败时，失败记录自动遗忘并被清理，因此内存占用只与近期的失败来源数量有关。
+// ===================================================================================
+package security
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LockoutError 表示用户名或来源IP因认证失败次数过多而被临时锁定。
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("认证失败次数过多，已被临时锁定，请在 %d 秒后重试", e.RetryAfterSeconds())
+}
+
+// RetryAfterSeconds 返回向上取整的剩余锁定秒数，用于 Retry-After 响应头。
+func (e *LockoutError) RetryAfterSeconds() int {
+	return retryAfterSeconds(e.RetryAfter)
+}
+
+// LockoutStatus 是一条失败记录的快照，供管理员查看。Kind 为 "user"、"account"、"totp" 或 "ip"，Kind 为 "user" 时 IP 为失败发生的来源IP。
+type LockoutStatus struct {
+	Kind        string    `json:"kind"`
+	Key         string    `json:"key"`
+	IP          string    `json:"ip,omitempty"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil string    `json:"locked_until,omitempty"` // RFC3339，未锁定时为空
+}
+
+type failureEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+var (
+	lockoutThreshold = 5
+	lockoutBase      = time.Minute
+	lockoutMax       = time.Hour
+	failureEntries   = make(map[string]*failureEntry) // key: "user\x00" + 用户名 + "\x00" + IP、"account\x00" + 用户名、"totp\x00" + 用户名 或 "ip\x00" + IP
+	lockoutMutex     = &sync.Mutex{}
+	lastLockoutPrune time.Time
+)
+
+// accountThresholdFactor 是用户名计数的阈值相对于普通阈值的倍数。
+const accountThresholdFactor = 4
+
+// SetLockoutPolicy 设置锁定阈值、基础锁定时长和最长锁定时长。threshold 小于等于 0 时关闭锁定（仍会统计失败次数）。
+func SetLockoutPolicy(threshold int, base, max time.Duration) {
+	lockoutMutex.Lock()
+	defer lockoutMutex.Unlock()
+	lockoutThreshold = threshold
+	lockoutBase = base
+	lockoutMax = max
+}
+
+func lockoutKey(kind, key string) string {
+	return kind + "\x00" + key
+}
+
+// userLockoutKey 返回用户名在某个来源IP上的失败记录键。
+func userLockoutKey(username, ip string) string {
+	return lockoutKey("user", username+"\x00"+ip)
+}
+
+// CheckLockout 检查用户名在该来源IP上、用户名本身或来源IP本身是否处于锁定期。username 或 ip 为空时跳过对应的检查。
+func CheckLockout(username, ip string) error {
+	now := time.Now()
+	lockoutMutex.Lock()
+	defer lockoutMutex.Unlock()
+	var keys []string
+	if username != "" {
+		keys = append(keys, userLockoutKey(username, ip), lockoutKey("account", username))
+	}
+	if ip != "" {
+		keys = append(keys, lockoutKey("ip", ip))
+	}
+	var wait time.Duration
+	for _, key := range keys {
+		if entry, ok := failureEntries[key]; ok && now.Before(entry.lockedUntil) {
+			if remaining := entry.lockedUntil.Sub(now); remaining > wait {
+				wait = remaining
+			}
+		}
+	}
+	if wait > 0 {
+		return &LockoutError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// RecordAuthFailure 记录一次认证失败，分别计入 (username, ip)、username 和 ip。username 为空（如用户不存在）时只计入来源IP。
+// 返回 true 表示这次失败触发了锁定。
+func RecordAuthFailure(username, ip string) bool {
+	now := time.Now()
+	lockoutMutex.Lock()
+	defer lockoutMutex.Unlock()
+	pruneFailures(now)
+
+	locked := false
+	if username != "" {
+		if noteFailure(userLockoutKey(username, ip), lockoutThreshold, now) {
+			locked = true
+		}
+		if noteFailure(lockoutKey("account", username), lockoutThreshold*accountThresholdFactor, now) {
+			locked = true
+		}
+	}
+	if ip != "" && noteFailure(lockoutKey("ip", ip), lockoutThreshold, now) {
+		locked = true
+	}
+	return locked
+}
+
+// CheckTOTPLockout 检查用户是否因 TOTP 验证码错误次数过多而被锁定，应在校验验证码之前调用。
+func CheckTOTPLockout(username string) error {
+	now := time.Now()
+	lockoutMutex.Lock()
+	defer lockoutMutex.Unlock()
+	if entry, ok := failureEntries[lockoutKey("totp", username)]; ok && now.Before(entry.lockedUntil) {
+		return &LockoutError{RetryAfter: entry.lockedUntil.Sub(now)}
+	}
+	return nil
+}
+
+// RecordTOTPFailure 记录一次 TOTP 验证码错误：与其他认证失败一样计入 (username, ip) 和 ip，同时计入只有验证码正确才会清除的用户 TOTP 记录。
+// 返回 true 表示这次失败触发了锁定。
+func RecordTOTPFailure(username, ip string) bool {
+	locked := RecordAuthFailure(username, ip)
+	lockoutMutex.Lock()
+	defer lockoutMutex.Unlock()
+	if noteFailure(lockoutKey("totp", username), lockoutThreshold, time.Now()) {
+		locked = true
+	}
+	return locked
+}
+
+// ClearTOTPFailures 在用户提交了正确的 TOTP 验证码后清除其 TOTP 失败记录。
+func ClearTOTPFailures(username string) {
+	lockoutMutex.Lock()
+	defer lockoutMutex.Unlock()
+	delete(failureEntries, lockoutKey("totp", username))
+}
+
+// noteFailure 为 key 累计一次失败，达到 threshold 时锁定。调用方必须持有 lockoutMutex。
+func noteFailure(key string, threshold int, now time.Time) bool {
+	entry, ok := failureEntries[key]
+	if !ok || now.Sub(entry.lastFailure) > lockoutMax {
+		entry = &failureEntry{}
+		failureEntries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+	if threshold <= 0 || entry.failures < threshold {
+		return false
+	}
+	duration := lockoutMax
+	if shift := entry.failures - threshold; shift < 32 {
+		if d := lockoutBase << shift; d > 0 && d < lockoutMax {
+			duration = d
+		}
+	}
+	entry.lockedUntil = now.Add(duration)
+	return true
+}
+
+// pruneFailures 每分钟最多执行一次，清理已解除锁定且超过上限时长没有新失败的记录。调用方必须持有 lockoutMutex。
+func pruneFailures(now time.Time) {
+	if now.Sub(lastLockoutPrune) < time.Minute {
+		return
+	}
+	for key, entry := range failureEntries {
+		if now.After(entry.lockedUntil) && now.Sub(entry.lastFailure) > lockoutMax {
+			delete(failureEntries, key)
+		}
+	}
+	lastLockoutPrune = now
+}
+
+// ClearAuthFailures 在用户从来源IP ip 认证成功后，清除该 (用户名, 来源IP) 的失败记录。
+// 来源IP和用户名的计数保留，直到超过上限时长没有新的失败。
+func ClearAuthFailures(username, ip string) {
+	lockoutMutex.Lock()
+	defer lockoutMutex.Unlock()
+	delete(failureEntries, userLockoutKey(username, ip))
+}
+
+// UnlockLockout 由管理员手动解除某个用户名 (kind 为 "user"，包括其在所有来源IP上的记录、用户名计数和 TOTP 记录) 或来源IP (kind 为 "ip") 的失败记录，返回是否有记录被清除。
+func UnlockLockout(kind, key string) bool {
+	lockoutMutex.Lock()
+	defer lockoutMutex.Unlock()
+	if kind != "user" {
+		k := lockoutKey(kind, key)
+		_, ok := failureEntries[k]
+		delete(failureEntries, k)
+		return ok
+	}
+	prefix := lockoutKey("user", key+"\x00")
+	found := false
+	for _, k := range []string{lockoutKey("account", key), lockoutKey("totp", key)} {
+		if _, ok := failureEntries[k]; ok {
+			delete(failureEntries, k)
+			found = true
+		}
+	}
+	for k := range failureEntries {
+		if strings.HasPrefix(k, prefix) {
+			delete(failureEntries, k)
+			found = true
+		}
+	}
+	return found
+}
+
+// LockoutEntries 返回所有仍在统计期内的失败记录，正在锁定的排在前面。
+func LockoutEntries() []LockoutStatus {
+	now := time.Now()
+	lockoutMutex.Lock()
+	defer lockoutMutex.Unlock()
+	pruneFailures(now)
+
+	entries := make([]LockoutStatus, 0, len(failureEntries))
+	for key, entry := range failureEntries {
+		kind, name, _ := strings.Cut(key, "\x00")
+		status := LockoutStatus{Kind: kind, Key: name, Failures: entry.failures, LastFailure: entry.lastFailure}
+		if kind == "user" {
+			status.Key, status.IP, _ = strings.Cut(name, "\x00")
+		}
+		if now.Before(entry.lockedUntil) {
+			status.LockedUntil = entry.lockedUntil.UTC().Format(time.RFC3339)
+		}
+		entries = append(entries, status)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if (entries[i].LockedUntil == "") != (entries[j].LockedUntil == "") {
+			return entries[i].LockedUntil != ""
+		}
+		return entries[i].LastFailure.After(entries[j].LastFailure)
+	})
+	return entries
+}
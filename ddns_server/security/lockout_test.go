@@ -0,0 +1,178 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func resetLockouts(threshold int) {
+	SetLockoutPolicy(threshold, time.Minute, time.Hour)
+	lockoutMutex.Lock()
+	failureEntries = make(map[string]*failureEntry)
+	lockoutMutex.Unlock()
+}
+
+func TestLockoutIsPerSourceIP(t *testing.T) {
+	resetLockouts(3)
+	defer resetLockouts(5)
+
+	for i := 0; i < 3; i++ {
+		RecordAuthFailure("alice", "198.51.100.7")
+	}
+	var lockErr *LockoutError
+	if err := CheckLockout("alice", "198.51.100.7"); !errors.As(err, &lockErr) || lockErr.RetryAfterSeconds() != 60 {
+		t.Fatalf("攻击者的来源IP应被锁定 60 秒，得到 %v", err)
+	}
+	if err := CheckLockout("alice", "203.0.113.9"); err != nil {
+		t.Fatalf("其他来源IP上的同一用户不应被锁定: %v", err)
+	}
+	if err := CheckLockout("", "198.51.100.7"); err == nil {
+		t.Fatal("来源IP本身应被锁定")
+	}
+
+	// 每多失败一次锁定时长翻倍
+	resetLockouts(3)
+	for i := 0; i < 4; i++ {
+		RecordAuthFailure("alice", "198.51.100.7")
+	}
+	if err := CheckLockout("alice", "198.51.100.7"); !errors.As(err, &lockErr) || lockErr.RetryAfterSeconds() != 120 {
+		t.Fatalf("第 4 次失败后应锁定 120 秒，得到 %v", err)
+	}
+}
+
+// lockoutEntry 返回指定的失败记录，不存在时 ok 为 false。
+func lockoutEntry(kind, key, ip string) (LockoutStatus, bool) {
+	for _, entry := range LockoutEntries() {
+		if entry.Kind == kind && entry.Key == key && entry.IP == ip {
+			return entry, true
+		}
+	}
+	return LockoutStatus{}, false
+}
+
+func TestClearAuthFailuresClearsOnlyUserAndIP(t *testing.T) {
+	resetLockouts(5)
+	defer resetLockouts(5)
+
+	RecordAuthFailure("alice", "198.51.100.7")
+	RecordAuthFailure("alice", "198.51.100.7")
+	RecordAuthFailure("bob", "198.51.100.7")
+	ClearAuthFailures("alice", "198.51.100.7")
+
+	if _, ok := lockoutEntry("user", "alice", "198.51.100.7"); ok {
+		t.Fatal("认证成功后应清除 alice 在该来源IP上的记录")
+	}
+	if entry, ok := lockoutEntry("ip", "198.51.100.7", ""); !ok || entry.Failures != 3 {
+		t.Fatalf("成功登录不应清除来源IP的计数，得到 %+v", entry)
+	}
+	if entry, ok := lockoutEntry("account", "alice", ""); !ok || entry.Failures != 2 {
+		t.Fatalf("成功登录不应清除用户名的计数，得到 %+v", entry)
+	}
+	if entry, ok := lockoutEntry("user", "bob", "198.51.100.7"); !ok || entry.Failures != 1 {
+		t.Fatalf("alice 的成功登录不应影响 bob 的记录，得到 %+v", entry)
+	}
+
+	// 攻击者在两次猜测之间用自己的账号登录，也无法重置来源IP的计数
+	RecordAuthFailure("bob", "198.51.100.7")
+	ClearAuthFailures("alice", "198.51.100.7")
+	RecordAuthFailure("bob", "198.51.100.7")
+	if err := CheckLockout("carol", "198.51.100.7"); err == nil {
+		t.Fatal("来源IP应被锁定")
+	}
+}
+
+func TestDistributedFailuresLockUsername(t *testing.T) {
+	resetLockouts(3)
+	defer resetLockouts(5)
+
+	// 每个来源IP只失败一次，(用户名, 来源IP) 和来源IP都不会达到阈值
+	for i := 0; i < 3*accountThresholdFactor; i++ {
+		ip := fmt.Sprintf("198.51.100.%d", i+1)
+		if err := CheckLockout("alice", ip); err != nil {
+			t.Fatalf("第 %d 次失败前不应被锁定: %v", i+1, err)
+		}
+		RecordAuthFailure("alice", ip)
+	}
+	if err := CheckLockout("alice", "203.0.113.9"); err == nil {
+		t.Fatal("分散在多个来源IP上的失败达到用户名阈值后应锁定该用户名")
+	}
+	if err := CheckLockout("bob", "203.0.113.9"); err != nil {
+		t.Fatalf("其他用户不应受影响: %v", err)
+	}
+	if !UnlockLockout("user", "alice") {
+		t.Fatal("UnlockLockout 应找到 alice 的记录")
+	}
+	if err := CheckLockout("alice", "203.0.113.9"); err != nil {
+		t.Fatalf("解除后不应再锁定: %v", err)
+	}
+}
+
+func TestUnlockLockoutUserCoversAllIPs(t *testing.T) {
+	resetLockouts(3)
+	defer resetLockouts(5)
+
+	RecordAuthFailure("alice", "198.51.100.7")
+	RecordAuthFailure("alice", "203.0.113.9")
+	if !UnlockLockout("user", "alice") {
+		t.Fatal("UnlockLockout 应找到 alice 的记录")
+	}
+	for _, entry := range LockoutEntries() {
+		if entry.Kind == "user" {
+			t.Fatalf("解除后不应再有用户记录: %+v", entry)
+		}
+	}
+	if UnlockLockout("user", "alice") {
+		t.Fatal("重复解除不应返回 true")
+	}
+	if !UnlockLockout("ip", "203.0.113.9") {
+		t.Fatal("UnlockLockout 应找到来源IP的记录")
+	}
+}
+
+func TestTOTPFailuresSurviveReauthentication(t *testing.T) {
+	resetLockouts(3)
+	defer resetLockouts(5)
+
+	// 持有密码的攻击者每次请求都能通过认证并清除 (用户名, 来源IP) 记录，TOTP 记录仍会累计
+	for i := 0; i < 3; i++ {
+		if err := CheckTOTPLockout("alice"); err != nil {
+			t.Fatalf("第 %d 次尝试前不应被锁定: %v", i+1, err)
+		}
+		locked := RecordTOTPFailure("alice", "198.51.100.7")
+		if locked != (i == 2) {
+			t.Fatalf("第 %d 次失败后 locked = %v", i+1, locked)
+		}
+		ClearAuthFailures("alice", "198.51.100.7")
+	}
+	var lockErr *LockoutError
+	if !errors.As(CheckTOTPLockout("alice"), &lockErr) || lockErr.RetryAfterSeconds() <= 0 {
+		t.Fatal("TOTP 错误次数达到阈值后应被锁定")
+	}
+	if err := CheckTOTPLockout("bob"); err != nil {
+		t.Fatalf("其他用户不应受影响: %v", err)
+	}
+
+	ClearTOTPFailures("alice")
+	if err := CheckTOTPLockout("alice"); err != nil {
+		t.Fatalf("验证码正确后应解除锁定: %v", err)
+	}
+}
+
+func TestTOTPFailuresCountTowardsSourceIP(t *testing.T) {
+	resetLockouts(2)
+	defer resetLockouts(5)
+
+	RecordTOTPFailure("alice", "198.51.100.7")
+	RecordAuthFailure("bob", "198.51.100.7")
+	if err := CheckLockout("carol", "198.51.100.7"); err == nil {
+		t.Fatal("TOTP 错误应与其他认证失败一起计入来源IP")
+	}
+	if !UnlockLockout("user", "alice") {
+		t.Fatal("UnlockLockout 应清除 alice 的 TOTP 记录")
+	}
+	if err := CheckTOTPLockout("alice"); err != nil {
+		t.Fatalf("解除后不应再锁定: %v", err)
+	}
+}
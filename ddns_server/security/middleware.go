@@ -1,76 +1,184 @@
 // ===================================================================================
 // File: ddns-server/security/middleware.go
-// Description: 提供HTTP中间件。目前包含 RateLimit（基于IP的速率限制）和 LimitRequestSize（请求体大小限制），用于抵御基本的DoS攻击。
+// Description: 提供HTTP中间件。目前包含 LimitRequestSize（请求体大小限制），速率限制见 ratelimit.go。
+// 同时提供 ClientIP，按受信任代理配置解析请求的真实来源地址，只采信 SetTrustedProxies 指定的唯一来源 (X-Forwarded-For、Forwarded、X-Real-IP 或 PROXY 协议)。
 // ===================================================================================
 package security
 
 import (
-	"log"
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
-	"time"
 )
 
+// 受信任代理传递客户端地址的方式，对应 server.ini 中 [server] 段的 client_ip_source。
+const (
+	ClientIPFromXForwardedFor = "x-forwarded-for"
+	ClientIPFromForwarded     = "forwarded"
+	ClientIPFromXRealIP       = "x-real-ip"
+	ClientIPFromProxyProtocol = "proxy_protocol"
+)
+
+// ValidateClientIPSource 检查 client_ip_source 的取值。
+func ValidateClientIPSource(source string) error {
+	switch source {
+	case ClientIPFromXForwardedFor, ClientIPFromForwarded, ClientIPFromXRealIP, ClientIPFromProxyProtocol:
+		return nil
+	}
+	return fmt.Errorf("无效的客户端地址来源 '%s'，可选: %s, %s, %s, %s", source, ClientIPFromXForwardedFor, ClientIPFromForwarded, ClientIPFromXRealIP, ClientIPFromProxyProtocol)
+}
+
 var (
-	clients           = make(map[string]time.Time)
-	clientsMutex      = &sync.Mutex{}
-	rateLimitDuration = 5 * time.Second
+	trustedProxies      []*net.IPNet
+	clientIPSource      = ClientIPFromXForwardedFor
+	trustedProxiesMutex = &sync.RWMutex{}
 )
 
-// getClientIP 优先从代理头中获取真实客户端IP地址。
-func getClientIP(r *http.Request) string {
-	// 尝试从 "X-Forwarded-For" 头获取IP。这个头可能包含一个IP列表 (client, proxy1, proxy2)，第一个通常是真实的客户端IP。
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// 按逗号分割，并取第一个非空IP
-		ips := strings.Split(xff, ",")
-		for _, ip := range ips {
-			trimmedIP := strings.TrimSpace(ip)
-			// 校验一下是否是合法的IP地址
-			if net.ParseIP(trimmedIP) != nil {
-				return trimmedIP
+// ParseCIDRs 解析 CIDR 列表，单个IP视为 /32 (IPv4) 或 /128 (IPv6)，空项被忽略。
+func ParseCIDRs(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		cidr := entry
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
 			}
 		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("无效的网段 '%s'", entry)
+		}
+		nets = append(nets, ipNet)
 	}
+	return nets, nil
+}
 
-	// 如果 "X-Forwarded-For" 不可用或格式不正确，尝试 "X-Real-IP"
-	if xrip := r.Header.Get("X-Real-IP"); xrip != "" {
-		if net.ParseIP(xrip) != nil {
-			return xrip
+// ContainsIP 判断 ip 是否属于 nets 中的任一网段。
+func ContainsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
 		}
 	}
+	return false
+}
 
-	// 如果以上代理头都不可用，则使用直连的IP地址
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+// SetTrustedProxies 设置受信任的反向代理网段 (CIDR 或单个IP) 以及它们传递客户端地址的方式 source。
+// 只有来自这些地址的请求才会采信 source 指定的代理头，其他代理头一律忽略：代理通常会原样转发它不处理的头，客户端可以借此伪造地址。
+func SetTrustedProxies(entries []string, source string) error {
+	nets, err := ParseCIDRs(entries)
 	if err != nil {
-		// 如果 SplitHostPort 失败 (例如 RemoteAddr 不含端口)，直接返回 RemoteAddr 本身
-		// 但也要确保它是个合法的IP
-		if net.ParseIP(r.RemoteAddr) != nil {
-			return r.RemoteAddr
-		}
-		// 如果都失败，返回空字符串，表示无法获取有效IP
+		return fmt.Errorf("无效的受信任代理地址: %w", err)
+	}
+	if err := ValidateClientIPSource(source); err != nil {
+		return err
+	}
+	trustedProxiesMutex.Lock()
+	trustedProxies = nets
+	clientIPSource = source
+	trustedProxiesMutex.Unlock()
+	return nil
+}
+
+func getClientIPSource() string {
+	trustedProxiesMutex.RLock()
+	defer trustedProxiesMutex.RUnlock()
+	return clientIPSource
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	trustedProxiesMutex.RLock()
+	defer trustedProxiesMutex.RUnlock()
+	return ContainsIP(trustedProxies, ip)
+}
+
+// ClientIP 返回请求的真实来源地址。
+// 只有当直连地址属于受信任代理时才会解析代理头，且只解析 client_ip_source 指定的一个头:
+// - x-forwarded-for / forwarded (RFC 7239 的 for= 参数): 从右向左遍历，跳过受信任代理，返回遇到的第一个不受信任的地址。
+// - x-real-ip: 代理写入的单个地址。
+// - proxy_protocol: 不解析任何代理头，直连地址即为 PROXY 头中的来源地址（见 proxyproto.go）。
+// 直连地址不受信任或指定的头不存在时返回直连地址。
+func ClientIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remote = host
+	}
+	remoteIP := net.ParseIP(remote)
+	if remoteIP == nil {
+		// 无法解析直连地址，返回空字符串，表示无法获取有效IP
 		return ""
 	}
-	return ip
+	if !isTrustedProxy(remoteIP) {
+		return remoteIP.String()
+	}
+
+	var hops []string
+	switch getClientIPSource() {
+	case ClientIPFromXForwardedFor:
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			hops = strings.Split(strings.Join(xff, ","), ",")
+		}
+	case ClientIPFromForwarded:
+		if forwarded := r.Header.Values("Forwarded"); len(forwarded) > 0 {
+			hops = forwardedFor(strings.Join(forwarded, ","))
+		}
+	case ClientIPFromXRealIP:
+		// 代理应覆盖而不是追加 X-Real-IP，出现多个值说明头未被正确设置，不予采信
+		if values := r.Header.Values("X-Real-IP"); len(values) == 1 {
+			if ip := parseHop(values[0]); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHop(hops[i])
+		if hop == nil {
+			// 链路中出现无法解析或被隐藏的地址 (如 "unknown")，无法继续可信地向左追溯
+			break
+		}
+		if !isTrustedProxy(hop) {
+			return hop.String()
+		}
+	}
+	return remoteIP.String()
 }
 
-func RateLimit(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := getClientIP(r)
-		clientsMutex.Lock()
-		lastSeen, exists := clients[ip]
-		if exists && time.Since(lastSeen) < rateLimitDuration {
-			clientsMutex.Unlock()
-			log.Printf("速率限制: IP %s 的请求过于频繁。", ip)
-			http.Error(w, "请求过于频繁，请稍后再试。", http.StatusTooManyRequests)
-			return
+// forwardedFor 按顺序取出 Forwarded 头中每个元素的 for= 参数。没有 for= 参数的元素记为空字符串，遍历到它时停止追溯。
+func forwardedFor(header string) []string {
+	var hops []string
+	for _, element := range strings.Split(header, ",") {
+		hop := ""
+		for _, pair := range strings.Split(element, ";") {
+			name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if found && strings.EqualFold(name, "for") {
+				hop = strings.Trim(value, `"`)
+			}
 		}
-		clients[ip] = time.Now()
-		clientsMutex.Unlock()
-		next.ServeHTTP(w, r)
-	})
+		hops = append(hops, hop)
+	}
+	return hops
 }
+
+// parseHop 解析代理链中的一个地址，兼容 Forwarded 头的 "[2001:db8::1]:4711"、"192.0.2.43:47011" 等带端口或方括号的写法。
+func parseHop(hop string) net.IP {
+	hop = strings.TrimSpace(hop)
+	if ip := net.ParseIP(hop); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+}
+
 func LimitRequestSize(next http.Handler, limit int64) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		r.Body = http.MaxBytesReader(w, r.Body, limit)
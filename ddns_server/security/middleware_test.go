@@ -0,0 +1,56 @@
+package security
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		remote  string
+		headers map[string][]string
+		want    string
+	}{
+		{"不受信任的直连地址忽略代理头", ClientIPFromXForwardedFor, "203.0.113.9:1234", map[string][]string{"X-Forwarded-For": {"1.2.3.4"}}, "203.0.113.9"},
+		{"XFF 从右向左跳过受信任代理", ClientIPFromXForwardedFor, "127.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"1.2.3.4, 5.6.7.8, 10.0.0.2"}}, "5.6.7.8"},
+		{"XFF 模式忽略伪造的 Forwarded", ClientIPFromXForwardedFor, "127.0.0.1:1234", map[string][]string{"Forwarded": {"for=1.2.3.4"}, "X-Forwarded-For": {"5.6.7.8"}}, "5.6.7.8"},
+		{"XFF 模式忽略 X-Real-IP", ClientIPFromXForwardedFor, "127.0.0.1:1234", map[string][]string{"X-Real-IP": {"9.9.9.9"}}, "127.0.0.1"},
+		{"Forwarded 模式", ClientIPFromForwarded, "127.0.0.1:1234", map[string][]string{"Forwarded": {`for=1.2.3.4, for="[2001:db8::1]:4711"`}, "X-Forwarded-For": {"5.6.7.8"}}, "2001:db8::1"},
+		{"Forwarded 遇到 unknown 停止追溯", ClientIPFromForwarded, "127.0.0.1:1234", map[string][]string{"Forwarded": {"for=1.2.3.4, for=unknown"}}, "127.0.0.1"},
+		{"X-Real-IP 模式", ClientIPFromXRealIP, "127.0.0.1:1234", map[string][]string{"X-Real-IP": {"9.9.9.9"}, "X-Forwarded-For": {"5.6.7.8"}}, "9.9.9.9"},
+		{"X-Real-IP 出现多个值不予采信", ClientIPFromXRealIP, "127.0.0.1:1234", map[string][]string{"X-Real-IP": {"9.9.9.9", "8.8.8.8"}}, "127.0.0.1"},
+		{"PROXY 协议模式忽略所有代理头", ClientIPFromProxyProtocol, "127.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"5.6.7.8"}, "Forwarded": {"for=1.2.3.4"}}, "127.0.0.1"},
+		{"无法解析的直连地址", ClientIPFromXForwardedFor, "bogus", nil, ""},
+	}
+	defer SetTrustedProxies(nil, ClientIPFromXForwardedFor)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetTrustedProxies([]string{"127.0.0.0/8", "10.0.0.0/8"}, tt.source); err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for name, values := range tt.headers {
+				for _, v := range values {
+					r.Header.Add(name, v)
+				}
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateClientIPSource(t *testing.T) {
+	for _, source := range []string{ClientIPFromXForwardedFor, ClientIPFromForwarded, ClientIPFromXRealIP, ClientIPFromProxyProtocol} {
+		if err := ValidateClientIPSource(source); err != nil {
+			t.Errorf("ValidateClientIPSource(%q) = %v", source, err)
+		}
+	}
+	if ValidateClientIPSource("X-Forwarded-For, Forwarded") == nil {
+		t.Error("ValidateClientIPSource 接受了多个头")
+	}
+}
@@ -0,0 +1,312 @@
+// ===================================================================================
+// File: ddns-server/security/mmdb.go
+// Description: 一个最小化的 MaxMind DB (.mmdb) 格式读取器，用于离线查询 GeoLite2 / GeoIP2 等数据库，不依赖网络和第三方库。
+// - 文件整体读入内存，元数据位于文件末尾的 "\xAB\xCD\xEFMaxMind.com" 标记之后。
+// - 搜索树支持 24 / 28 / 32 位的记录长度，IPv4 地址在 IPv6 数据库中按 ::a.b.c.d 查找。
+// - 数据段解码为 map[string]interface{}、[]interface{}、string、uint64、int64、float64、bool 和 []byte (uint128 / bytes)。
+// 所有读取都做了越界检查，损坏的文件只会返回错误，不会导致崩溃。
+// ===================================================================================
+package security
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbMaxDepth 限制解码时的嵌套和指针跳转深度，防止损坏的文件造成无限递归。
+const mmdbMaxDepth = 32
+
+var errMMDBCorrupt = errors.New("mmdb 文件已损坏")
+
+// MMDB 是已加载到内存中的 MaxMind DB 数据库。
+type MMDB struct {
+	buf          []byte
+	data         []byte // 数据段
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	ipv4Start    uint
+	DatabaseType string
+}
+
+// OpenMMDB 读取并解析 path 处的 .mmdb 文件。
+func OpenMMDB(path string) (*MMDB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	idx := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if idx < 0 {
+		return nil, fmt.Errorf("%s 不是有效的 mmdb 文件: 找不到元数据", path)
+	}
+	metaSection := buf[idx+len(mmdbMetadataMarker):]
+	raw, _, err := (&mmdbDecoder{buf: metaSection}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("解析 %s 的元数据失败: %w", path, err)
+	}
+	meta, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("解析 %s 的元数据失败: %w", path, errMMDBCorrupt)
+	}
+
+	db := &MMDB{buf: buf}
+	nodeCount, _ := meta["node_count"].(uint64)
+	recordSize, _ := meta["record_size"].(uint64)
+	ipVersion, _ := meta["ip_version"].(uint64)
+	db.DatabaseType, _ = meta["database_type"].(string)
+	db.nodeCount, db.recordSize, db.ipVersion = uint(nodeCount), uint(recordSize), uint(ipVersion)
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("%s 使用了不支持的记录长度 %d", path, db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("%s 使用了不支持的 IP 版本 %d", path, db.ipVersion)
+	}
+
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+16 > uint(idx) {
+		return nil, fmt.Errorf("%s 的搜索树大小与文件不符: %w", path, errMMDBCorrupt)
+	}
+	db.data = buf[treeSize+16 : idx]
+
+	// IPv6 数据库中 IPv4 地址位于 ::/96 之下，预先走完前 96 位
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			if node, err = db.readNode(node, 0); err != nil {
+				return nil, err
+			}
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// readNode 读取搜索树中 node 节点的左 (bit 为 0) 或右 (bit 为 1) 记录。
+func (db *MMDB) readNode(node uint, bit uint) (uint, error) {
+	offset := node * db.recordSize / 4
+	b := db.buf
+	switch db.recordSize {
+	case 24:
+		off := offset + bit*3
+		if off+3 > uint(len(b)) {
+			return 0, errMMDBCorrupt
+		}
+		return uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2]), nil
+	case 28:
+		if offset+7 > uint(len(b)) {
+			return 0, errMMDBCorrupt
+		}
+		if bit == 0 {
+			return uint(b[offset+3]&0xF0)<<20 | uint(b[offset])<<16 | uint(b[offset+1])<<8 | uint(b[offset+2]), nil
+		}
+		return uint(b[offset+3]&0x0F)<<24 | uint(b[offset+4])<<16 | uint(b[offset+5])<<8 | uint(b[offset+6]), nil
+	default:
+		off := offset + bit*4
+		if off+4 > uint(len(b)) {
+			return 0, errMMDBCorrupt
+		}
+		return uint(binary.BigEndian.Uint32(b[off : off+4])), nil
+	}
+}
+
+// Lookup 查询 ip 对应的数据记录，没有记录时 found 为 false。
+func (db *MMDB) Lookup(ip net.IP) (record interface{}, found bool, err error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if db.ipVersion == 4 {
+		return nil, false, nil
+	}
+
+	node := uint(0)
+	if len(ip) == net.IPv4len && db.ipVersion == 6 {
+		node = db.ipv4Start
+	}
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		if node, err = db.readNode(node, bit); err != nil {
+			return nil, false, err
+		}
+	}
+	if node == db.nodeCount {
+		return nil, false, nil
+	}
+	if node < db.nodeCount {
+		return nil, false, errMMDBCorrupt
+	}
+	offset := node - db.nodeCount - 16
+	record, _, err = (&mmdbDecoder{buf: db.data}).decode(offset, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	return record, true, nil
+}
+
+// mmdbDecoder 解码数据段 (或元数据段) 中的值，指针均相对于 buf 的起始位置。
+type mmdbDecoder struct {
+	buf []byte
+}
+
+func (d *mmdbDecoder) bytesAt(offset, size uint) ([]byte, error) {
+	if offset > uint(len(d.buf)) || size > uint(len(d.buf))-offset {
+		return nil, errMMDBCorrupt
+	}
+	return d.buf[offset : offset+size], nil
+}
+
+// decode 解码 offset 处的值，返回值以及紧随其后的偏移量。
+func (d *mmdbDecoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, errMMDBCorrupt
+	}
+	ctrl, err := d.bytesAt(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+	typeNum := uint(ctrl[0] >> 5)
+
+	if typeNum == 1 { // 指针
+		ss := uint(ctrl[0]>>3) & 0x3
+		b, err := d.bytesAt(offset, ss+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		var pointer uint
+		switch ss {
+		case 0:
+			pointer = uint(ctrl[0]&0x7)<<8 | uint(b[0])
+		case 1:
+			pointer = (uint(ctrl[0]&0x7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			pointer = (uint(ctrl[0]&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			pointer = uint(binary.BigEndian.Uint32(b))
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, offset + ss + 1, err
+	}
+
+	if typeNum == 0 { // 扩展类型
+		ext, err := d.bytesAt(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typeNum = 7 + uint(ext[0])
+		offset++
+	}
+
+	size := uint(ctrl[0] & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.bytesAt(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+
+	switch typeNum {
+	case 2: // UTF-8 字符串
+		b, err := d.bytesAt(offset, size)
+		return string(b), offset + size, err
+	case 3: // double
+		b, err := d.bytesAt(offset, 8)
+		if err != nil || size != 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset + 8, nil
+	case 4, 10: // bytes、uint128
+		b, err := d.bytesAt(offset, size)
+		return append([]byte(nil), b...), offset + size, err
+	case 5, 6, 9: // uint16、uint32、uint64
+		if size > 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		b, err := d.bytesAt(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset + size, nil
+	case 8: // int32
+		if size > 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		b, err := d.bytesAt(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		if size == 4 {
+			return int64(int32(v)), offset + size, nil
+		}
+		return int64(v), offset + size, nil
+	case 7: // map
+		if size > uint(len(d.buf)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errMMDBCorrupt
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[name] = value
+			offset = next
+		}
+		return m, offset, nil
+	case 11: // array
+		if size > uint(len(d.buf)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case 14: // boolean，值保存在 size 中
+		return size != 0, offset, nil
+	case 15: // float
+		b, err := d.bytesAt(offset, 4)
+		if err != nil || size != 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset + 4, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: 未知的数据类型 %d", errMMDBCorrupt, typeNum)
+	}
+}
@@ -0,0 +1,188 @@
+package security
+
+import (
+	"errors"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMMDBDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		buf    []byte
+		offset uint
+		want   interface{}
+		next   uint
+	}{
+		{"字符串", []byte{0x43, 'a', 'b', 'c'}, 0, "abc", 4},
+		{"空字符串", []byte{0x40}, 0, "", 1},
+		{"扩展长度的字符串", append([]byte{0x5d, 0x01}, make([]byte, 30)...), 0, string(make([]byte, 30)), 32},
+		{"uint16", []byte{0xa2, 0x01, 0x02}, 0, uint64(0x0102), 3},
+		{"uint32", []byte{0xc4, 0xde, 0xad, 0xbe, 0xef}, 0, uint64(0xdeadbeef), 5},
+		{"uint32 零值", []byte{0xc0}, 0, uint64(0), 1},
+		{"uint64", []byte{0x08, 0x02, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, 0, uint64(1) << 56, 10},
+		{"int32 负数", []byte{0x04, 0x01, 0xff, 0xff, 0xff, 0xfe}, 0, int64(-2), 6},
+		{"int32 短编码", []byte{0x02, 0x01, 0x01, 0x00}, 0, int64(256), 4},
+		{"double", []byte{0x68, 0x40, 0x09, 0x21, 0xfb, 0x54, 0x44, 0x2d, 0x18}, 0, math.Pi, 9},
+		{"float", []byte{0x04, 0x08, 0x3f, 0xc0, 0x00, 0x00}, 0, float64(1.5), 6},
+		{"bytes", []byte{0x82, 0x01, 0x02}, 0, []byte{0x01, 0x02}, 3},
+		{"布尔值", []byte{0x01, 0x07}, 0, true, 2},
+		{"数组", []byte{0x02, 0x04, 0x41, 'x', 0xa1, 0x05}, 0, []interface{}{"x", uint64(5)}, 6},
+		{"嵌套 map", []byte{0xe1, 0x42, 'c', 'c', 0xe1, 0x41, 'k', 0x42, 'C', 'N'}, 0, map[string]interface{}{"cc": map[string]interface{}{"k": "CN"}}, 10},
+		// 从偏移 3 开始解码，map 的值是指向偏移 0 处字符串的指针
+		{"指针", []byte{0x42, 'h', 'i', 0xe1, 0x41, 'p', 0x20, 0x00}, 3, map[string]interface{}{"p": "hi"}, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, err := (&mmdbDecoder{buf: tt.buf}).decode(tt.offset, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || next != tt.next {
+				t.Fatalf("decode = %#v (next %d), want %#v (next %d)", got, next, tt.want, tt.next)
+			}
+		})
+	}
+}
+
+func TestMMDBDecodeCorrupt(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"空输入", nil},
+		{"字符串越界", []byte{0x45, 'a'}},
+		{"扩展长度缺少字节", []byte{0x5d}},
+		{"double 长度错误", []byte{0x64, 0x00, 0x00, 0x00, 0x00}},
+		{"uint 过长", []byte{0x09, 0x02, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"int32 过长", []byte{0x05, 0x01, 1, 2, 3, 4, 5}},
+		{"map 键不是字符串", []byte{0xe1, 0xa1, 0x01, 0x40}},
+		{"map 数量超出缓冲区", []byte{0xfd, 0xff}},
+		{"未知类型", []byte{0x00, 0x09}},
+		{"指针自引用", []byte{0x20, 0x00}},
+		{"指针越界", []byte{0x27, 0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := (&mmdbDecoder{buf: tt.buf}).decode(0, 0); err == nil {
+				t.Fatal("损坏的输入应返回错误")
+			}
+		})
+	}
+}
+
+func TestMMDBLookupFixtures(t *testing.T) {
+	country, err := OpenMMDB(filepath.Join("testdata", "country-v6.mmdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	asn, err := OpenMMDB(filepath.Join("testdata", "asn-v4.mmdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if country.DatabaseType != "Test-Country" || asn.DatabaseType != "Test-ASN" {
+		t.Fatalf("database_type = %q, %q", country.DatabaseType, asn.DatabaseType)
+	}
+
+	tests := []struct {
+		name  string
+		db    *MMDB
+		ip    string
+		want  interface{}
+		found bool
+	}{
+		{"IPv6 库中的 IPv4 地址", country, "198.51.100.7", map[string]interface{}{"country": map[string]interface{}{"iso_code": "CN"}}, true},
+		{"IPv4 映射地址", country, "::ffff:203.0.113.200", map[string]interface{}{"registered_country": map[string]interface{}{"iso_code": "US"}}, true},
+		{"IPv6 地址", country, "2001:db8:1::1", map[string]interface{}{"country": map[string]interface{}{"iso_code": "DE"}}, true},
+		{"IPv6 库中没有记录", country, "192.0.2.1", nil, false},
+		{"IPv4 库", asn, "203.0.113.1", map[string]interface{}{"autonomous_system_number": uint64(64496), "autonomous_system_organization": "EXAMPLE"}, true},
+		{"IPv4 库中网段之外", asn, "203.0.113.129", nil, false},
+		{"IPv4 库不支持 IPv6", asn, "2001:db8::1", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found, err := tt.db.Lookup(net.ParseIP(tt.ip))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.found || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Lookup(%s) = %#v, %v, want %#v, %v", tt.ip, got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestLookupGeo(t *testing.T) {
+	if err := LoadGeoIP(filepath.Join("testdata", "country-v6.mmdb"), filepath.Join("testdata", "asn-v4.mmdb")); err != nil {
+		t.Fatal(err)
+	}
+	defer LoadGeoIP("", "")
+
+	tests := []struct {
+		ip   string
+		want GeoInfo
+	}{
+		{"198.51.100.7", GeoInfo{Country: "CN", ASN: 4134, ASOrg: "CHINANET-BACKBONE No.31,Jin-rong Street"}},
+		{"203.0.113.5", GeoInfo{Country: "US", ASN: 64496, ASOrg: "EXAMPLE"}},
+		{"2001:db8::1", GeoInfo{Country: "DE"}},
+		{"192.0.2.1", GeoInfo{}},
+		{"not-an-ip", GeoInfo{}},
+	}
+	for _, tt := range tests {
+		if got := LookupGeo(tt.ip); got != tt.want {
+			t.Errorf("LookupGeo(%q) = %+v, want %+v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestOpenMMDBRejectsCorruptFiles(t *testing.T) {
+	good, err := os.ReadFile(filepath.Join("testdata", "country-v6.mmdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker := len(good) - len(mmdbMetadataMarker)
+	for ; marker >= 0; marker-- {
+		if string(good[marker:marker+len(mmdbMetadataMarker)]) == string(mmdbMetadataMarker) {
+			break
+		}
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"没有元数据", good[:marker]},
+		{"元数据被截断", good[:len(good)-5]},
+		{"搜索树大于文件", append(append([]byte(nil), good[marker:]...), 0)},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "corrupt.mmdb")
+			if err := os.WriteFile(path, tt.data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := OpenMMDB(path); err == nil {
+				t.Fatal("损坏的文件应返回错误")
+			}
+		})
+	}
+
+	// 搜索树指向数据段之外时，查询返回错误而不是崩溃
+	broken := append([]byte(nil), good...)
+	copy(broken[0:3], []byte{0xff, 0xff, 0xff})
+	path := filepath.Join(dir, "broken-tree.mmdb")
+	if err := os.WriteFile(path, broken, 0600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenMMDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Lookup(net.ParseIP("2001:db8::1")); !errors.Is(err, errMMDBCorrupt) {
+		t.Fatalf("Lookup 应返回 errMMDBCorrupt，得到 %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+// ===================================================================================
+// File: ddns-server/security/mtls.go
+// Description: 提供双向 TLS (mTLS) 客户端证书认证。
+// - 客户端证书是可选的：未提供证书的客户端仍可使用 secret_token 认证。
+// - 提供的证书必须由 client_ca_file 中的 CA 签发，且不能出现在 client_crl_file 吊销列表中，否则 TLS 握手直接失败。
+// - 吊销列表文件变化后会自动重新加载，吊销设备证书无需重启服务。
+// - CertIdentities 返回已验证证书的 CN 和 SAN，由处理器映射到 users.json 中的 cert_names。
+// ===================================================================================
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClientCertVerifier 持有客户端证书的 CA 和当前生效的吊销列表。
+type ClientCertVerifier struct {
+	pool    *x509.CertPool
+	cas     []*x509.Certificate
+	crlFile string
+
+	mu      sync.RWMutex
+	revoked map[string]bool
+	crlTime time.Time
+}
+
+// NewClientCertVerifier 加载 CA 证书包和（可选的）吊销列表文件。
+func NewClientCertVerifier(caFile, crlFile string) (*ClientCertVerifier, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取客户端 CA 文件 %s: %w", caFile, err)
+	}
+	v := &ClientCertVerifier{pool: x509.NewCertPool(), crlFile: crlFile, revoked: make(map[string]bool)}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("解析客户端 CA 证书失败: %w", err)
+		}
+		v.pool.AddCert(cert)
+		v.cas = append(v.cas, cert)
+	}
+	if len(v.cas) == 0 {
+		return nil, fmt.Errorf("客户端 CA 文件 %s 中没有有效的 PEM 证书", caFile)
+	}
+	if crlFile != "" {
+		if err := v.reloadCRL(); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// reloadCRL 读取吊销列表 (PEM 或 DER)。吊销列表必须由已配置的某个 CA 签名。
+func (v *ClientCertVerifier) reloadCRL() error {
+	info, err := os.Stat(v.crlFile)
+	if err != nil {
+		return fmt.Errorf("无法读取吊销列表文件 %s: %w", v.crlFile, err)
+	}
+	data, err := os.ReadFile(v.crlFile)
+	if err != nil {
+		return fmt.Errorf("无法读取吊销列表文件 %s: %w", v.crlFile, err)
+	}
+
+	var ders [][]byte
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "X509 CRL" {
+			ders = append(ders, block.Bytes)
+		}
+	}
+	if len(ders) == 0 {
+		ders = append(ders, data)
+	}
+
+	revoked := make(map[string]bool)
+	for _, der := range ders {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return fmt.Errorf("解析吊销列表失败: %w", err)
+		}
+		if !v.signedByCA(crl) {
+			return fmt.Errorf("吊销列表不是由已配置的客户端 CA 签发的")
+		}
+		if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+			log.Printf("警告: 吊销列表 %s 已过期 (NextUpdate: %s)，请尽快更新。", v.crlFile, crl.NextUpdate.Format(time.RFC3339))
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			revoked[revocationKey(crl.RawIssuer, entry.SerialNumber.String())] = true
+		}
+	}
+
+	v.mu.Lock()
+	v.revoked = revoked
+	v.crlTime = info.ModTime()
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *ClientCertVerifier) signedByCA(crl *x509.RevocationList) bool {
+	for _, ca := range v.cas {
+		if crl.CheckSignatureFrom(ca) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func revocationKey(rawIssuer []byte, serial string) string {
+	return string(rawIssuer) + "|" + serial
+}
+
+// Watch 在后台按 interval 检查吊销列表文件，文件变化后重新加载；加载失败时保留旧列表。
+func (v *ClientCertVerifier) Watch(interval time.Duration) {
+	if v.crlFile == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			info, err := os.Stat(v.crlFile)
+			if err != nil {
+				continue
+			}
+			v.mu.RLock()
+			unchanged := info.ModTime().Equal(v.crlTime)
+			v.mu.RUnlock()
+			if unchanged {
+				continue
+			}
+			if err := v.reloadCRL(); err != nil {
+				log.Printf("警告: 吊销列表已变化但重新加载失败，继续使用旧列表: %v", err)
+				continue
+			}
+			log.Printf("已重新加载客户端证书吊销列表: %s", v.crlFile)
+		}
+	}()
+}
+
+// Apply 在服务端 TLS 配置上启用可选的客户端证书校验。
+func (v *ClientCertVerifier) Apply(cfg *tls.Config) {
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	cfg.ClientCAs = v.pool
+	cfg.VerifyConnection = v.verifyConnection
+}
+
+// verifyConnection 在证书链校验通过后检查吊销状态。VerifyConnection 在会话恢复时同样会被调用。
+func (v *ClientCertVerifier) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.VerifiedChains) == 0 {
+		return nil
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			if v.revoked[revocationKey(cert.RawIssuer, cert.SerialNumber.String())] {
+				return fmt.Errorf("客户端证书 (序列号 %s) 已被吊销", cert.SerialNumber.String())
+			}
+		}
+	}
+	return nil
+}
+
+// CertIdentities 返回请求中已验证客户端证书的身份名称（CN、DNS、邮箱、URI 类型的 SAN），均为小写。未提供证书时返回 nil。
+func CertIdentities(r *http.Request) []string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	var names []string
+	if leaf.Subject.CommonName != "" {
+		names = append(names, leaf.Subject.CommonName)
+	}
+	names = append(names, leaf.DNSNames...)
+	names = append(names, leaf.EmailAddresses...)
+	for _, uri := range leaf.URIs {
+		names = append(names, uri.String())
+	}
+	for i, name := range names {
+		names[i] = strings.ToLower(name)
+	}
+	return names
+}
@@ -0,0 +1,62 @@
+// ===================================================================================
+// File: ddns-server/security/password.go
+// Description: 提供用户 secret_token 的加盐哈希与校验。哈希格式为 "pbkdf2-sha256$<迭代次数>$<盐>$<摘要>"，盐和摘要均为 base64 编码；校验时使用常量时间比较。
+// ===================================================================================
+package security
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	secretHashScheme     = "pbkdf2-sha256"
+	secretHashIterations = 100000
+	secretHashSaltSize   = 16
+	secretHashKeySize    = 32
+)
+
+// HashSecret 为 secret 生成一个随机加盐的 PBKDF2-SHA256 哈希。
+func HashSecret(secret string) (string, error) {
+	salt := make([]byte, secretHashSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	derived, err := pbkdf2.Key(sha256.New, secret, salt, secretHashIterations, secretHashKeySize)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", secretHashScheme, secretHashIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(derived)), nil
+}
+
+// VerifySecret 校验 secret 是否与 HashSecret 生成的哈希匹配。哈希格式无效时返回 false。
+func VerifySecret(encoded, secret string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != secretHashScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	derived, err := pbkdf2.Key(sha256.New, secret, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(derived, expected) == 1
+}
@@ -0,0 +1,58 @@
+package security
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashSecret(t *testing.T) {
+	// 令牌哈希与主密钥无关，配置主密钥后仍为加盐的 PBKDF2
+	defer SetMasterKey(nil)
+	SetMasterKey([]byte("0123456789abcdef0123456789abcdef"))
+
+	first, err := HashSecret("tok-alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := HashSecret("tok-alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(first, "pbkdf2-sha256$100000$") || first == second {
+		t.Fatalf("应生成随机加盐的 PBKDF2 哈希: %s, %s", first, second)
+	}
+	SetMasterKey(nil)
+	if !VerifySecret(first, "tok-alice") || !VerifySecret(second, "tok-alice") {
+		t.Fatal("哈希应能在不依赖主密钥的情况下校验")
+	}
+}
+
+func TestVerifySecret(t *testing.T) {
+	hash, err := HashSecret("tok-alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(hash, "$")
+	tests := []struct {
+		name    string
+		encoded string
+		secret  string
+		want    bool
+	}{
+		{"正确的令牌", hash, "tok-alice", true},
+		{"错误的令牌", hash, "tok-bob", false},
+		{"空令牌", hash, "", false},
+		{"未知的方案", "hmac-sha256$" + parts[2] + "$" + parts[3], "tok-alice", false},
+		{"迭代次数无效", strings.Join([]string{parts[0], "0", parts[2], parts[3]}, "$"), "tok-alice", false},
+		{"盐不是 base64", strings.Join([]string{parts[0], parts[1], "!!", parts[3]}, "$"), "tok-alice", false},
+		{"摘要为空", strings.Join([]string{parts[0], parts[1], parts[2], ""}, "$"), "tok-alice", false},
+		{"字段数量错误", parts[0] + "$" + parts[1], "tok-alice", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifySecret(tt.encoded, tt.secret); got != tt.want {
+				t.Fatalf("VerifySecret() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// ===================================================================================
+// File: ddns-server/security/proxyproto.go
+// Description: 提供 PROXY 协议 (v1 文本格式和 v2 二进制格式) 的监听器封装，供 HAProxy 等四层负载均衡器传递客户端的真实地址。
+// - 只有来自受信任代理 (trusted_proxies) 的连接才会解析 PROXY 头，且必须携带；其他连接原样处理，无法伪造来源地址。
+// - PROXY 头在连接的处理协程中读取（而不是在 Accept 中），慢速或恶意的连接不会阻塞其他连接，并受 proxyHeaderTimeout 限制。
+// - 在 client_ip_source = proxy_protocol 时启用。解析出的来源地址通过 RemoteAddr 返回，ClientIP 直接使用该地址，不再采信任何代理头。
+// - LOCAL 命令（如负载均衡器的健康检查）和 "PROXY UNKNOWN" 保留直连地址。
+// ===================================================================================
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout 是读取 PROXY 头的最长时间。
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyV2Signature 是 PROXY 协议 v2 头的固定前缀。
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrInvalidProxyHeader 表示受信任代理的连接没有携带有效的 PROXY 头。
+var ErrInvalidProxyHeader = errors.New("无效的 PROXY 协议头")
+
+// ProxyProtocolListener 将 ln 封装为解析 PROXY 协议头的监听器。
+func ProxyProtocolListener(ln net.Listener) net.Listener {
+	return &proxyListener{Listener: ln}
+}
+
+type proxyListener struct {
+	net.Listener
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+// init 在第一次 Read 或 RemoteAddr 时读取 PROXY 头。
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.remote = c.Conn.RemoteAddr()
+		tcpAddr, ok := c.remote.(*net.TCPAddr)
+		if !ok || !isTrustedProxy(tcpAddr.IP) {
+			return
+		}
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+		source, err := readProxyHeader(c.reader)
+		if err != nil {
+			c.err = fmt.Errorf("%w (来自 %s): %v", ErrInvalidProxyHeader, c.remote, err)
+			return
+		}
+		if source != nil {
+			c.remote = source
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remote
+}
+
+// readProxyHeader 读取 v1 或 v2 格式的 PROXY 头，返回其中的来源地址；LOCAL / UNKNOWN 时返回 nil。
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	prefix, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(prefix, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	if bytes.HasPrefix(prefix, []byte("PROXY ")) {
+		return readProxyV1(r)
+	}
+	return nil, errors.New("缺少 PROXY 头")
+}
+
+// readProxyV1 解析 "PROXY TCP4 <src> <dst> <sport> <dport>\r\n"，整行最长 107 字节。
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("v1 头过长或缺少 CRLF")
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("无法解析的 v1 头 %q", string(line))
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("无法解析的 v1 来源地址 %s:%s", fields[2], fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 解析 v2 二进制头: 12 字节签名、版本/命令、地址族/协议、2 字节长度，随后是地址和可选的 TLV（忽略）。
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("不支持的 v2 版本 %d", header[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	switch header[12] & 0x0F {
+	case 0x0: // LOCAL
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("不支持的 v2 命令 %d", header[12]&0x0F)
+	}
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, errors.New("v2 IPv4 地址长度不足")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, errors.New("v2 IPv6 地址长度不足")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		// UNSPEC 或非 TCP 的地址族，保留直连地址
+		return nil, nil
+	}
+}
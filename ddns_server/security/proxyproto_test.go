@@ -0,0 +1,119 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// proxyV2Header 构造一个 v2 头，command 为 0 (LOCAL) 或 1 (PROXY)，family 为地址族/协议字节。
+func proxyV2Header(command, family byte, payload []byte) []byte {
+	header := append([]byte(nil), proxyV2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(payload)))
+	return append(header, payload...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	ipv4Payload := []byte{198, 51, 100, 7, 10, 0, 0, 1, 0x30, 0x39, 0x01, 0xbb}
+	ipv6Payload := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0x1f, 0x90, 0x01, 0xbb)
+	tests := []struct {
+		name    string
+		input   []byte
+		want    string // 空字符串表示保留直连地址
+		wantErr bool
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 198.51.100.7 10.0.0.1 12345 443\r\n"), "198.51.100.7:12345", false},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 8080 443\r\n"), "[2001:db8::1]:8080", false},
+		{"v1 UNKNOWN", []byte("PROXY UNKNOWN\r\n"), "", false},
+		{"v1 地址族与地址不符", []byte("PROXY TCP4 2001:db8::1 10.0.0.1 1 443\r\n"), "", true},
+		{"v1 端口无效", []byte("PROXY TCP4 198.51.100.7 10.0.0.1 70000 443\r\n"), "", true},
+		{"v1 字段缺失", []byte("PROXY TCP4 198.51.100.7\r\n"), "", true},
+		{"v1 缺少 CRLF", []byte("PROXY TCP4 198.51.100.7 10.0.0.1 1 443\n"), "", true},
+		{"v1 过长", []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"), "", true},
+		{"v2 IPv4", proxyV2Header(1, 0x11, ipv4Payload), "198.51.100.7:12345", false},
+		{"v2 IPv6", proxyV2Header(1, 0x21, ipv6Payload), "[2001:db8::1]:8080", false},
+		{"v2 带 TLV", proxyV2Header(1, 0x11, append(append([]byte(nil), ipv4Payload...), 0x04, 0x00, 0x01, 0xff)), "198.51.100.7:12345", false},
+		{"v2 LOCAL", proxyV2Header(0, 0x00, nil), "", false},
+		{"v2 UNSPEC", proxyV2Header(1, 0x00, nil), "", false},
+		{"v2 IPv4 地址长度不足", proxyV2Header(1, 0x11, ipv4Payload[:8]), "", true},
+		{"v2 未知命令", proxyV2Header(2, 0x11, ipv4Payload), "", true},
+		{"v2 长度超出数据", proxyV2Header(1, 0x11, ipv4Payload)[:20], "", true},
+		{"v2 版本错误", append(append([]byte(nil), proxyV2Signature...), 0x11, 0x11, 0, 0), "", true},
+		{"没有 PROXY 头", []byte("GET / HTTP/1.1\r\nHost: a\r\n\r\n"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := readProxyHeader(bufio.NewReader(bytes.NewReader(tt.input)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readProxyHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tt.want {
+				t.Fatalf("readProxyHeader() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// dialProxyListener 建立一个经过 ProxyProtocolListener 的连接，发送 data 后返回服务端看到的来源地址和读到的内容。
+func dialProxyListener(t *testing.T, data string) (string, string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	pln := ProxyProtocolListener(ln)
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	client.(*net.TCPConn).CloseWrite()
+
+	conn, err := pln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	body, err := io.ReadAll(conn)
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	return host, string(body), err
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	defer SetTrustedProxies(nil, ClientIPFromXForwardedFor)
+
+	t.Run("受信任代理", func(t *testing.T) {
+		SetTrustedProxies([]string{"127.0.0.0/8"}, ClientIPFromProxyProtocol)
+		host, body, err := dialProxyListener(t, "PROXY TCP4 198.51.100.7 10.0.0.1 12345 443\r\nhello")
+		if err != nil || host != "198.51.100.7" || body != "hello" {
+			t.Fatalf("得到 %q, %q, %v", host, body, err)
+		}
+	})
+	t.Run("受信任代理缺少 PROXY 头", func(t *testing.T) {
+		SetTrustedProxies([]string{"127.0.0.0/8"}, ClientIPFromProxyProtocol)
+		if _, _, err := dialProxyListener(t, "GET / HTTP/1.1\r\n\r\n"); err == nil {
+			t.Fatal("缺少 PROXY 头的连接应返回错误")
+		}
+	})
+	t.Run("不受信任的连接不解析 PROXY 头", func(t *testing.T) {
+		SetTrustedProxies([]string{"10.0.0.0/8"}, ClientIPFromProxyProtocol)
+		data := "PROXY TCP4 198.51.100.7 10.0.0.1 12345 443\r\nhello"
+		host, body, err := dialProxyListener(t, data)
+		if err != nil || host != "127.0.0.1" || body != data {
+			t.Fatalf("得到 %q, %q, %v", host, body, err)
+		}
+	})
+}
@@ -0,0 +1,255 @@
+// ===================================================================================
+// File: ddns-server/security/ratelimit.go
+// Description: 提供基于令牌桶的速率限制，用于抵御基本的DoS攻击并保护阿里云 API 额度。
+// - RateLimit 中间件按来源IP (ClientIP，只采信受信任代理的代理头) 限速，每条路由可以配置独立的速率和突发量，IPv6 地址按 /64 前缀合并计数。
+// - AllowUser 在请求通过认证后按用户名限速，可为个别用户单独配置。
+// - 令牌桶按最近使用顺序保存在 LRU 链表中，闲置并补满后被清理；桶的总数有上限，达到上限时以 O(1) 淘汰最久未使用的桶，新的来源不会因此被拒绝，内存占用也是有界的。
+// - 被限速的请求返回 429，并通过 Retry-After 头告知客户端需要等待的秒数；dyndns2 等有固定返回格式的路由可以通过 SetRateLimitResponder 自定义响应内容。
+// ===================================================================================
+package security
+
+import (
+	"container/list"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateRule 描述一个令牌桶: 每分钟补充 PerMinute 个令牌，最多积攒 Burst 个。PerMinute 小于等于 0 表示不限速。
+type RateRule struct {
+	PerMinute float64
+	Burst     int
+}
+
+func (rule RateRule) unlimited() bool {
+	return rule.PerMinute <= 0
+}
+
+// RateLimitError 表示请求超出了速率限制。
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("请求过于频繁，请在 %d 秒后重试", e.RetryAfterSeconds())
+}
+
+// RetryAfterSeconds 返回向上取整的等待秒数，用于 Retry-After 响应头。
+func (e *RateLimitError) RetryAfterSeconds() int {
+	return retryAfterSeconds(e.RetryAfter)
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+type routeRule struct {
+	path string
+	rule RateRule
+}
+
+// RateLimitResponder 向被 RateLimit 中间件拒绝的请求写出响应，响应中应包含 429 状态码和 Retry-After 头。
+type RateLimitResponder func(w http.ResponseWriter, err *RateLimitError)
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+	rule   RateRule
+}
+
+var (
+	ipRule       = RateRule{PerMinute: 12, Burst: 5}
+	routeRules   []routeRule
+	userRule     = RateRule{PerMinute: 30, Burst: 10}
+	userRules    map[string]RateRule
+	bucketIdle   = 10 * time.Minute
+	maxBuckets   = 100000
+	buckets      = make(map[string]*list.Element) // key: "ip" 或 "user" + "\x00" + 路由 + "\x00" + 来源
+	bucketLRU    = list.New()                     // 元素为 *bucket，最近使用的在前
+	bucketsMutex = &sync.Mutex{}
+	lastBucketGC time.Time
+	fullLogTime  time.Time
+	responders   = make(map[string]RateLimitResponder)
+)
+
+// SetRateLimitResponder 为路径 path 设置被限速时的响应方式，以 "/" 结尾的路径按前缀匹配。
+func SetRateLimitResponder(path string, respond RateLimitResponder) {
+	bucketsMutex.Lock()
+	defer bucketsMutex.Unlock()
+	responders[path] = respond
+}
+
+// matchResponder 返回请求路径对应的自定义响应方式，没有时返回 nil。调用方必须持有 bucketsMutex。
+func matchResponder(path string) RateLimitResponder {
+	if respond, ok := responders[path]; ok {
+		return respond
+	}
+	for prefix, respond := range responders {
+		if strings.HasSuffix(prefix, "/") && strings.HasPrefix(path, prefix) {
+			return respond
+		}
+	}
+	return nil
+}
+
+// SetRateLimits 设置速率限制策略。routes 的键为请求路径，以 "/" 结尾的键按前缀匹配（如 "/u/"），其余按完整路径匹配；
+// 没有匹配的路由使用 defaultRule。users 为个别用户的限速，其余用户使用 userDefault。
+func SetRateLimits(defaultRule RateRule, routes map[string]RateRule, userDefault RateRule, users map[string]RateRule, idle time.Duration, maxEntries int) {
+	var rules []routeRule
+	for path, rule := range routes {
+		rules = append(rules, routeRule{path: path, rule: rule})
+	}
+	// 最长的路径优先匹配
+	sort.Slice(rules, func(i, j int) bool { return len(rules[i].path) > len(rules[j].path) })
+
+	bucketsMutex.Lock()
+	defer bucketsMutex.Unlock()
+	ipRule = defaultRule
+	routeRules = rules
+	userRule = userDefault
+	userRules = users
+	bucketIdle = idle
+	maxBuckets = maxEntries
+	buckets = make(map[string]*list.Element)
+	bucketLRU.Init()
+}
+
+// matchRoute 返回请求路径对应的限速规则，以及用于区分令牌桶的路由名（未单独配置的路由共用空路由名）。
+func matchRoute(path string) (string, RateRule) {
+	for _, r := range routeRules {
+		if path == r.path || (strings.HasSuffix(r.path, "/") && strings.HasPrefix(path, r.path)) {
+			return r.path, r.rule
+		}
+	}
+	return "", ipRule
+}
+
+// rateLimitSource 返回来源IP的计数键。IPv6 用户通常拥有整个 /64 网段，按单个地址计数很容易被绕过。
+func rateLimitSource(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return ip
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+// take 从 key 对应的令牌桶中取出一个令牌。取不到时返回需要等待的时长。调用方必须持有 bucketsMutex。
+func take(key string, rule RateRule, now time.Time) (time.Duration, bool) {
+	var b *bucket
+	if elem, ok := buckets[key]; ok {
+		bucketLRU.MoveToFront(elem)
+		b = elem.Value.(*bucket)
+	} else {
+		if len(buckets) >= maxBuckets {
+			evictOldestBucket(now)
+		}
+		b = &bucket{key: key, tokens: float64(rule.Burst), last: now, rule: rule}
+		buckets[key] = bucketLRU.PushFront(b)
+	}
+
+	perSecond := rule.PerMinute / 60
+	b.tokens = math.Min(float64(rule.Burst), b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	b.rule = rule
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / perSecond * float64(time.Second)), false
+}
+
+// evictOldestBucket 在令牌桶数量达到上限时淘汰最久未使用的桶。调用方必须持有 bucketsMutex。
+func evictOldestBucket(now time.Time) {
+	elem := bucketLRU.Back()
+	if elem == nil {
+		return
+	}
+	if now.Sub(fullLogTime) > time.Minute {
+		log.Printf("警告: 速率限制的令牌桶数量已达上限 (%d)，开始淘汰最久未使用的来源。", maxBuckets)
+		fullLogTime = now
+	}
+	bucketLRU.Remove(elem)
+	delete(buckets, elem.Value.(*bucket).key)
+}
+
+// evictIdleBuckets 从链表尾部清理闲置超过 bucketIdle 且已补满的令牌桶，补满的桶与新建的桶等价，删除后不会放宽限制。
+// 链表按最近使用排序，遇到闲置时间不足的桶即可停止。每分钟最多执行一次，调用方必须持有 bucketsMutex。
+func evictIdleBuckets(now time.Time) {
+	if now.Sub(lastBucketGC) < time.Minute {
+		return
+	}
+	lastBucketGC = now
+	for elem := bucketLRU.Back(); elem != nil; {
+		b := elem.Value.(*bucket)
+		idle := now.Sub(b.last)
+		if idle <= bucketIdle {
+			return
+		}
+		prev := elem.Prev()
+		if b.tokens+idle.Seconds()*b.rule.PerMinute/60 >= float64(b.rule.Burst) {
+			bucketLRU.Remove(elem)
+			delete(buckets, b.key)
+		}
+		elem = prev
+	}
+}
+
+// allow 从令牌桶中取出一个令牌，被限速时返回需要等待的时长和 false。
+func allow(key string, rule RateRule) (time.Duration, bool) {
+	if rule.unlimited() {
+		return 0, true
+	}
+	now := time.Now()
+	bucketsMutex.Lock()
+	defer bucketsMutex.Unlock()
+	evictIdleBuckets(now)
+	return take(key, rule, now)
+}
+
+// AllowUser 按用户名限速，应在请求通过认证后调用，避免他人冒用用户名耗尽该用户的额度。
+func AllowUser(username string) error {
+	bucketsMutex.Lock()
+	rule, ok := userRules[username]
+	if !ok {
+		rule = userRule
+	}
+	bucketsMutex.Unlock()
+	if wait, ok := allow("user\x00\x00"+username, rule); !ok {
+		return &RateLimitError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// RateLimit 按来源IP和路由限速。无法确定来源地址的请求不受限制。
+func RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r)
+		if ip == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		bucketsMutex.Lock()
+		route, rule := matchRoute(r.URL.Path)
+		respond := matchResponder(r.URL.Path)
+		bucketsMutex.Unlock()
+		if wait, ok := allow("ip\x00"+route+"\x00"+rateLimitSource(ip), rule); !ok {
+			log.Printf("速率限制: IP %s 访问 %s 的请求过于频繁。", ip, r.URL.Path)
+			if respond != nil {
+				respond(w, &RateLimitError{RetryAfter: wait})
+				return
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+			http.Error(w, "请求过于频繁，请稍后再试。", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
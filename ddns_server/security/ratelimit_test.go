@@ -0,0 +1,99 @@
+package security
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func resetRateLimits(maxEntries int) {
+	SetRateLimits(RateRule{PerMinute: 60, Burst: 2}, nil, RateRule{PerMinute: 60, Burst: 2}, nil, time.Minute, maxEntries)
+}
+
+func TestTakeRefillsAtConfiguredRate(t *testing.T) {
+	resetRateLimits(10)
+	defer resetRateLimits(100000)
+	rule := RateRule{PerMinute: 60, Burst: 2}
+	now := time.Unix(1700000000, 0)
+
+	bucketsMutex.Lock()
+	defer bucketsMutex.Unlock()
+	for i := 0; i < 2; i++ {
+		if _, ok := take("k", rule, now); !ok {
+			t.Fatalf("突发量内的第 %d 个请求被拒绝", i+1)
+		}
+	}
+	wait, ok := take("k", rule, now)
+	if ok || wait != time.Second {
+		t.Fatalf("超出突发量: wait = %v, ok = %v，期望等待 1s", wait, ok)
+	}
+	if _, ok := take("k", rule, now.Add(time.Second)); !ok {
+		t.Fatal("补充一个令牌后应放行")
+	}
+}
+
+func TestTakeEvictsLeastRecentlyUsedWhenFull(t *testing.T) {
+	resetRateLimits(3)
+	defer resetRateLimits(100000)
+	rule := RateRule{PerMinute: 1, Burst: 1}
+	now := time.Unix(1700000000, 0)
+
+	bucketsMutex.Lock()
+	defer bucketsMutex.Unlock()
+	for i := 0; i < 3; i++ {
+		take(fmt.Sprintf("k%d", i), rule, now)
+	}
+	// 再次使用 k0，使 k1 成为最久未使用的桶
+	take("k0", rule, now)
+	if _, ok := take("new", rule, now); !ok {
+		t.Fatal("桶数量达到上限时不应拒绝新的来源")
+	}
+	if len(buckets) != 3 || bucketLRU.Len() != 3 {
+		t.Fatalf("桶数量应保持在上限: map %d, list %d", len(buckets), bucketLRU.Len())
+	}
+	if _, ok := buckets["k1"]; ok {
+		t.Fatal("应淘汰最久未使用的 k1")
+	}
+	for _, key := range []string{"k0", "k2", "new"} {
+		if _, ok := buckets[key]; !ok {
+			t.Fatalf("%s 不应被淘汰", key)
+		}
+	}
+}
+
+func TestEvictIdleBucketsKeepsDepletedBuckets(t *testing.T) {
+	resetRateLimits(10)
+	defer resetRateLimits(100000)
+	now := time.Unix(1700000000, 0)
+
+	bucketsMutex.Lock()
+	defer bucketsMutex.Unlock()
+	take("refilled", RateRule{PerMinute: 60, Burst: 1}, now)
+	take("slow", RateRule{PerMinute: 0.01, Burst: 1}, now)
+	take("recent", RateRule{PerMinute: 60, Burst: 1}, now.Add(2*time.Minute))
+	lastBucketGC = time.Time{}
+	evictIdleBuckets(now.Add(2*time.Minute + time.Second))
+
+	if _, ok := buckets["refilled"]; ok {
+		t.Fatal("闲置且已补满的桶应被清理")
+	}
+	if _, ok := buckets["slow"]; !ok {
+		t.Fatal("尚未补满的桶不应被清理")
+	}
+	if _, ok := buckets["recent"]; !ok {
+		t.Fatal("最近使用的桶不应被清理")
+	}
+}
+
+func TestRateLimitSourceGroupsIPv6By64(t *testing.T) {
+	tests := []struct{ ip, want string }{
+		{"198.51.100.7", "198.51.100.7"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+		{"2001:db8:1:2::ffff", "2001:db8:1:2::/64"},
+	}
+	for _, tt := range tests {
+		if got := rateLimitSource(tt.ip); got != tt.want {
+			t.Errorf("rateLimitSource(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// ===================================================================================
+// File: ddns-server/security/replay.go
+// Description: 提供重放攻击防护。客户端在每个加密载荷中附带时间戳 (timestamp) 和随机请求ID (request_id)：
+// - 时间戳与服务端时钟的偏差超过允许范围的请求会被拒绝，使旧密文失效；
+// - 允许范围内的请求ID会被记录下来，同一请求ID再次出现时即判定为重放。
+// 已记录的请求ID在其时间戳超出允许范围后自动清理，因此内存占用只与时间窗口内的请求量有关。
+// ===================================================================================
+package security
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrReplayedRequest 表示该请求ID已经被使用过。
+	ErrReplayedRequest = errors.New("重放请求已被拒绝: 该请求ID已被使用")
+	// ErrStaleRequest 表示请求时间戳超出了允许的时钟偏差范围。
+	ErrStaleRequest = errors.New("请求已过期或客户端时钟偏差过大，请校准系统时间后重试")
+	// ErrMissingNonce 表示载荷中缺少时间戳或请求ID。
+	ErrMissingNonce = errors.New("载荷中缺少有效的 timestamp 或 request_id 字段")
+)
+
+var requestIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{16,128}$`)
+
+var (
+	maxClockSkew   = 5 * time.Minute
+	seenRequests   = make(map[string]time.Time) // key: username + request_id, value: 过期时间
+	seenMutex      = &sync.Mutex{}
+	lastSeenPruned time.Time
+)
+
+// SetMaxClockSkew 设置允许的客户端与服务端时钟偏差。
+func SetMaxClockSkew(d time.Duration) {
+	seenMutex.Lock()
+	defer seenMutex.Unlock()
+	maxClockSkew = d
+}
+
+// CheckReplay 校验请求的时间戳和请求ID，并将通过校验的请求ID记为已使用。
+func CheckReplay(username, requestID string, timestamp int64) error {
+	if timestamp == 0 || !requestIDRegex.MatchString(requestID) {
+		return ErrMissingNonce
+	}
+	now := time.Now()
+	requestTime := time.Unix(timestamp, 0)
+
+	seenMutex.Lock()
+	defer seenMutex.Unlock()
+	if requestTime.Before(now.Add(-maxClockSkew)) || requestTime.After(now.Add(maxClockSkew)) {
+		return ErrStaleRequest
+	}
+	if now.Sub(lastSeenPruned) > time.Minute {
+		for key, expiry := range seenRequests {
+			if now.After(expiry) {
+				delete(seenRequests, key)
+			}
+		}
+		lastSeenPruned = now
+	}
+	key := username + "\x00" + requestID
+	if _, seen := seenRequests[key]; seen {
+		return ErrReplayedRequest
+	}
+	seenRequests[key] = requestTime.Add(maxClockSkew)
+	return nil
+}
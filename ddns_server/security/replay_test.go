@@ -0,0 +1,38 @@
+package security
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckReplay(t *testing.T) {
+	SetMaxClockSkew(time.Minute)
+	defer SetMaxClockSkew(5 * time.Minute)
+	seenMutex.Lock()
+	seenRequests = make(map[string]time.Time)
+	seenMutex.Unlock()
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name      string
+		username  string
+		requestID string
+		timestamp int64
+		want      error
+	}{
+		{"首次出现", "alice", "0123456789abcdef", now, nil},
+		{"同一请求ID重放", "alice", "0123456789abcdef", now, ErrReplayedRequest},
+		{"其他用户的同一请求ID", "bob", "0123456789abcdef", now, nil},
+		{"时间戳过旧", "alice", "fedcba9876543210", now - 120, ErrStaleRequest},
+		{"时间戳超前", "alice", "fedcba9876543211", now + 120, ErrStaleRequest},
+		{"缺少时间戳", "alice", "fedcba9876543212", 0, ErrMissingNonce},
+		{"请求ID过短", "alice", "short", now, ErrMissingNonce},
+		{"请求ID含非法字符", "alice", "0123456789abcdef!", now, ErrMissingNonce},
+	}
+	for _, tt := range tests {
+		if err := CheckReplay(tt.username, tt.requestID, tt.timestamp); !errors.Is(err, tt.want) {
+			t.Errorf("%s: CheckReplay() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
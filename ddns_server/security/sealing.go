@@ -0,0 +1,80 @@
+// ===================================================================================
+// File: ddns-server/security/sealing.go
+// Description: 使用服务端主密钥 (master key) 对落盘的敏感数据（如用户的 encryption_key）进行 AES-GCM 封装，防止 users.json 泄露时密钥直接暴露。
+// 主密钥为32字节，以 base64 或十六进制编码，从环境变量 GODDNS_MASTER_KEY 或 server.ini 指定的文件中读取。
+// ===================================================================================
+package security
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const sealedPrefix = "sealed:v1:"
+
+// sealingAD 是封装数据的附加认证数据，防止封装后的密文被挪作它用。
+var sealingAD = []byte("goddns/sealed/v1")
+
+var masterKey []byte
+
+// ParseMasterKey 解析 base64 或十六进制编码的32字节主密钥。
+func ParseMasterKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if key, err := hex.DecodeString(encoded); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("主密钥必须是32字节，并以 base64 或十六进制编码")
+}
+
+// GenerateMasterKey 生成一个新的 base64 编码的主密钥。
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// SetMasterKey 设置用于封装落盘数据的主密钥，传入 nil 表示未配置主密钥。
+func SetMasterKey(key []byte) {
+	masterKey = key
+}
+
+// MasterKeyConfigured 返回是否配置了主密钥。
+func MasterKeyConfigured() bool {
+	return masterKey != nil
+}
+
+// Seal 使用主密钥封装明文，返回带版本前缀的字符串。
+func Seal(plaintext string) (string, error) {
+	if masterKey == nil {
+		return "", fmt.Errorf("未配置主密钥")
+	}
+	encrypted, err := Encrypt(masterKey, []byte(plaintext), sealingAD)
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + encrypted, nil
+}
+
+// Unseal 解开由 Seal 封装的数据。
+func Unseal(sealed string) (string, error) {
+	if masterKey == nil {
+		return "", fmt.Errorf("未配置主密钥，无法解开已封装的数据")
+	}
+	data, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if !ok {
+		return "", fmt.Errorf("不支持的封装格式")
+	}
+	plaintext, err := Decrypt(masterKey, data, sealingAD)
+	if err != nil {
+		return "", fmt.Errorf("解封失败，主密钥可能不正确: %w", err)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,57 @@
+package security
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestParseMasterKey(t *testing.T) {
+	raw := []byte("0123456789abcdef0123456789abcdef")
+	for _, encoded := range []string{hex.EncodeToString(raw), base64.StdEncoding.EncodeToString(raw), " " + hex.EncodeToString(raw) + "\n"} {
+		if key, err := ParseMasterKey(encoded); err != nil || string(key) != string(raw) {
+			t.Errorf("ParseMasterKey(%q) = %x, %v", encoded, key, err)
+		}
+	}
+	for _, encoded := range []string{"", "abcd", base64.StdEncoding.EncodeToString(raw[:16])} {
+		if _, err := ParseMasterKey(encoded); err == nil {
+			t.Errorf("ParseMasterKey(%q) 应返回错误", encoded)
+		}
+	}
+}
+
+func TestSealUnseal(t *testing.T) {
+	defer SetMasterKey(nil)
+	SetMasterKey(nil)
+	if _, err := Seal("secret"); err == nil {
+		t.Fatal("未配置主密钥时 Seal 应返回错误")
+	}
+
+	encoded, err := GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseMasterKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetMasterKey(key)
+	sealed, err := Seal("0123456789abcdef0123456789abcdef")
+	if err != nil || !strings.HasPrefix(sealed, sealedPrefix) {
+		t.Fatalf("Seal = %q, %v", sealed, err)
+	}
+	if plaintext, err := Unseal(sealed); err != nil || plaintext != "0123456789abcdef0123456789abcdef" {
+		t.Fatalf("Unseal = %q, %v", plaintext, err)
+	}
+	if _, err := Unseal(strings.TrimPrefix(sealed, sealedPrefix)); err == nil {
+		t.Fatal("缺少版本前缀的数据应被拒绝")
+	}
+
+	other, _ := GenerateMasterKey()
+	otherKey, _ := ParseMasterKey(other)
+	SetMasterKey(otherKey)
+	if _, err := Unseal(sealed); err == nil {
+		t.Fatal("错误的主密钥应无法解封")
+	}
+}
@@ -0,0 +1,29 @@
+// ===================================================================================
+// File: ddns-server/security/signature.go
+// Description: 提供设备请求签名的校验。设备以 Ed25519 私钥对 SigningInput 签名，服务端用登记的公钥验证。
+// ===================================================================================
+package security
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+)
+
+// ParseDevicePublicKey 解析 base64 编码的 Ed25519 公钥。
+func ParseDevicePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("设备公钥格式错误，应为 base64 编码的 Ed25519 公钥")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// VerifyDeviceSignature 校验设备对 message 的签名 (base64)。
+func VerifyDeviceSignature(publicKey, message []byte, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize || len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(ed25519.PublicKey(publicKey), message, sig)
+}
@@ -0,0 +1,71 @@
+#!/usr/bin/env python3
+# 生成 mmdb_test.go 使用的最小 MaxMind DB 测试库（24 位记录长度），在 security/testdata 目录下执行:
+#   python3 mkmmdb.py
+# country-v6.mmdb: IPv6 树，IPv4 网段位于 ::/96 之下；asn-v4.mmdb: IPv4 树。
+import ipaddress
+
+
+def enc(v):
+    if isinstance(v, str):
+        b = v.encode()
+        head = bytes([(2 << 5) | len(b)]) if len(b) < 29 else bytes([(2 << 5) | 29, len(b) - 29])
+        return head + b
+    if isinstance(v, int):
+        b = v.to_bytes((v.bit_length() + 7) // 8, 'big') if v else b''
+        return bytes([(6 << 5) | len(b)]) + b
+    if isinstance(v, dict):
+        out = bytes([(7 << 5) | len(v)])
+        for k, x in v.items():
+            out += enc(k) + enc(x)
+        return out
+    raise TypeError(v)
+
+
+def build(path, prefixes, dbtype, ipv):
+    data = b''
+    offs = []
+    for _, rec in prefixes:
+        offs.append(len(data))
+        data += enc(rec)
+    nodes = [[None, None]]
+    for i, (p, _) in enumerate(prefixes):
+        net = ipaddress.ip_network(p)
+        bits, nbits, total = int(net.network_address), net.prefixlen, 32
+        if net.version == 6 or ipv == 6:
+            total = 128
+            if net.version == 4:
+                nbits += 96
+        n = 0
+        for d in range(nbits):
+            bit = (bits >> (total - 1 - d)) & 1
+            if d == nbits - 1:
+                nodes[n][bit] = ('data', i)
+            else:
+                if not isinstance(nodes[n][bit], int):
+                    nodes.append([None, None])
+                    nodes[n][bit] = len(nodes) - 1
+                n = nodes[n][bit]
+    count = len(nodes)
+
+    def record(r):
+        if r is None:
+            return count
+        if isinstance(r, tuple):
+            return count + 16 + offs[r[1]]
+        return r
+
+    tree = b''.join(record(a).to_bytes(3, 'big') + record(b).to_bytes(3, 'big') for a, b in nodes)
+    meta = {"node_count": count, "record_size": 24, "ip_version": ipv, "database_type": dbtype, "binary_format_major_version": 2}
+    with open(path, 'wb') as f:
+        f.write(tree + b'\0' * 16 + data + b'\xab\xcd\xefMaxMind.com' + enc(meta))
+
+
+build('country-v6.mmdb', [
+    ("198.51.100.0/24", {"country": {"iso_code": "CN"}}),
+    ("203.0.113.0/24", {"registered_country": {"iso_code": "US"}}),
+    ("2001:db8::/32", {"country": {"iso_code": "DE"}}),
+], "Test-Country", 6)
+build('asn-v4.mmdb', [
+    ("198.51.100.0/24", {"autonomous_system_number": 4134, "autonomous_system_organization": "CHINANET-BACKBONE No.31,Jin-rong Street"}),
+    ("203.0.113.0/25", {"autonomous_system_number": 64496, "autonomous_system_organization": "EXAMPLE"}),
+], "Test-ASN", 4)
@@ -0,0 +1,135 @@
+// ===================================================================================
+// File: ddns-server/security/tls.go
+// Description: 提供服务端原生 TLS 支持。
+// - CertReloader 按固定间隔检查证书/私钥文件的修改时间，证书轮换（如 certbot 续期）后无需重启即可生效。
+// - NewTLSConfig 统一 TLS 策略：最低 TLS 1.2，TLS 1.2 下只允许 ECDHE + AEAD 套件。
+// - RedirectToHTTPS 用于可选的 HTTP→HTTPS 跳转监听。
+// ===================================================================================
+package security
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader 持有当前生效的服务端证书，并在证书文件变化时自动重新加载。
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+// NewCertReloader 加载证书和私钥。首次加载失败会直接返回错误，避免服务以无效证书启动。
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) reload() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("无法读取证书文件 %s: %w", r.certFile, err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("无法读取私钥文件 %s: %w", r.keyFile, err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("加载证书失败: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.certTime = certInfo.ModTime()
+	r.keyTime = keyInfo.ModTime()
+	r.mu.Unlock()
+	return nil
+}
+
+// changed 判断证书或私钥文件自上次加载后是否被修改。
+func (r *CertReloader) changed() bool {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !certInfo.ModTime().Equal(r.certTime) || !keyInfo.ModTime().Equal(r.keyTime)
+}
+
+// Watch 在后台按 interval 检查证书文件。新证书加载失败（例如证书和私钥只更新了一半）时保留旧证书并在下一轮重试。
+func (r *CertReloader) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if !r.changed() {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Printf("警告: 证书文件已变化但重新加载失败，继续使用旧证书: %v", err)
+				continue
+			}
+			log.Printf("已重新加载 TLS 证书: %s", r.certFile)
+		}
+	}()
+}
+
+// GetCertificate 实现 tls.Config.GetCertificate，始终返回当前生效的证书。
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// NewTLSConfig 根据证书加载器和最低版本 ("1.2" 或 "1.3") 构造服务端 TLS 配置。
+func NewTLSConfig(reloader *CertReloader, minVersion string) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+	if minVersion == "1.3" {
+		cfg.MinVersion = tls.VersionTLS13
+	}
+	return cfg
+}
+
+// RedirectToHTTPS 返回一个把所有请求 308 跳转到 HTTPS 端口的处理器。
+// 308 会保留原请求方法和请求体，但客户端在跳转前已经以明文发出了请求，因此它只用于引导浏览器/旧配置，不能代替在客户端配置 https:// 地址。
+func RedirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		target := "https://" + net.JoinHostPort(host, httpsPort) + r.URL.RequestURI()
+		if httpsPort == "443" {
+			target = "https://" + host + r.URL.RequestURI()
+		}
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,44 @@
+// ===================================================================================
+// File: ddns-server/security/token.go
+// Description: 提供随机令牌的生成与摘要函数。令牌由服务端生成、具有足够的随机性，因此只需保存其 SHA-256 摘要即可用于查找和校验，明文令牌只在生成时返回给用户一次。
+// ===================================================================================
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+)
+
+var tokenRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{32,128}$`)
+
+// GenerateToken 生成一个可直接放入URL的随机令牌 (32字节随机数的 base64url 编码)。
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// GenerateID 生成一个 n 字节随机数的十六进制标识，用于不需要保密的查找键（如 API 令牌的 id 部分）。
+func GenerateID(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashToken 返回令牌的 SHA-256 摘要 (十六进制)。
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidTokenFormat 判断字符串是否符合 GenerateToken 生成的令牌格式。
+func ValidTokenFormat(token string) bool {
+	return tokenRegex.MatchString(token)
+}
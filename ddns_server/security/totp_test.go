@@ -0,0 +1,95 @@
+package security
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret 是 RFC 4226 / RFC 6238 附录中 SHA1 测试向量使用的密钥 "12345678901234567890" 的 base32 编码。
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTPRFC4226Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		if got := hotp(key, uint64(counter)); got != code {
+			t.Errorf("hotp(counter=%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestVerifyTOTPRFC6238Vectors(t *testing.T) {
+	// RFC 6238 附录 B 的 SHA1 向量为 8 位，这里取其后 6 位
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0)
+		counter, ok := VerifyTOTP(rfcSecret, tt.code, now, 0)
+		if !ok || counter != tt.unix/totpPeriod {
+			t.Errorf("VerifyTOTP(T=%d, %s) = %d, %v", tt.unix, tt.code, counter, ok)
+		}
+	}
+}
+
+func TestVerifyTOTPRejects(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	tests := []struct {
+		name        string
+		secret      string
+		code        string
+		now         time.Time
+		lastCounter int64
+	}{
+		{"错误的验证码", rfcSecret, "050472", now, 0},
+		{"长度不符", rfcSecret, "14050471", now, 0},
+		{"已使用过的计数器", rfcSecret, "050471", now, current},
+		{"超出允许的时钟偏差", rfcSecret, "050471", now.Add(2 * totpPeriod * time.Second), 0},
+		{"无效的密钥", "not base32!", "050471", now, 0},
+		{"空密钥", "", "050471", now, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := VerifyTOTP(tt.secret, tt.code, tt.now, tt.lastCounter); ok {
+				t.Fatal("应拒绝该验证码")
+			}
+		})
+	}
+}
+
+func TestVerifyTOTPAcceptsSkewAndFormatting(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	// 前一个时间步的验证码在允许的偏差范围内
+	if counter, ok := VerifyTOTP(strings.ToLower(rfcSecret), " 050471 ", now.Add(totpPeriod*time.Second), 0); !ok || counter != now.Unix()/totpPeriod {
+		t.Fatalf("VerifyTOTP = %d, %v", counter, ok)
+	}
+}
+
+func TestGenerateTOTPSecretRoundTrip(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("密钥应为 160 位的 base32: %q, %v", secret, err)
+	}
+	now := time.Now()
+	if _, ok := VerifyTOTP(secret, hotp(key, uint64(now.Unix()/totpPeriod)), now, 0); !ok {
+		t.Fatal("新生成的密钥应能通过校验")
+	}
+	uri := TOTPURI("goddns", "alice", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/goddns:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("TOTPURI = %s", uri)
+	}
+}
@@ -14,6 +14,9 @@ var (
 	domainPartRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
 	rrRegex         = regexp.MustCompile(`^@$|^[a-zA-Z0-9*]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
 	usernameRegex   = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,20}$`)
+	labelRegex      = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,32}$`)
+	// allowedLines 是允许用户使用的阿里云解析线路。
+	allowedLines = map[string]bool{"default": true, "telecom": true, "unicom": true, "mobile": true, "oversea": true}
 )
 
 func ValidateDomain(domain string) error {
@@ -47,3 +50,21 @@ func ValidateUsername(username string) error {
 	}
 	return nil
 }
+func ValidateDeviceName(name string) error {
+	if !labelRegex.MatchString(name) {
+		return fmt.Errorf("设备名 '%s' 包含无效字符或长度不符合要求(1-32位)", name)
+	}
+	return nil
+}
+func ValidateTokenName(name string) error {
+	if !labelRegex.MatchString(name) {
+		return fmt.Errorf("令牌名 '%s' 包含无效字符或长度不符合要求(1-32位)", name)
+	}
+	return nil
+}
+func ValidateLine(line string) error {
+	if !allowedLines[line] {
+		return fmt.Errorf("解析线路 '%s' 无效，可选值: default, telecom, unicom, mobile, oversea", line)
+	}
+	return nil
+}